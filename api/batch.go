@@ -0,0 +1,28 @@
+package api
+
+import "context"
+
+// PutEggs stores several secrets in any Store, a few at a time, and returns
+// the error of each item by index (nil where it succeeded). One failure
+// doesn't stop the others.
+func PutEggs(ctx context.Context, store Store, owner string, reqs []PutEggRequest) []error {
+	return forEachBounded(ctx, len(reqs), DefaultConcurrency, func(ctx context.Context, i int) error {
+		return store.PutEgg(ctx, owner, reqs[i])
+	})
+}
+
+// BreakEggs deletes several secrets in any Store, a few at a time, and
+// returns the error of each by index like PutEggs
+func BreakEggs(ctx context.Context, store Store, owner string, secretIDs []string) []error {
+	return forEachBounded(ctx, len(secretIDs), DefaultConcurrency, func(ctx context.Context, i int) error {
+		return store.BreakEgg(ctx, owner, secretIDs[i])
+	})
+}
+
+// PurgeEggs permanently deletes several secrets, a few at a time, and
+// returns the error of each by index like PutEggs
+func PurgeEggs(ctx context.Context, store TrashStore, owner string, secretIDs []string) []error {
+	return forEachBounded(ctx, len(secretIDs), DefaultConcurrency, func(ctx context.Context, i int) error {
+		return store.PurgeEgg(ctx, owner, secretIDs[i])
+	})
+}
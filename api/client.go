@@ -2,34 +2,105 @@ package api
 
 import (
 	"bytes"
+	"cmp"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// DefaultTimeout bounds a single HTTP request. API Gateway gives up on
+// integrations after 29 seconds, so waiting longer than this is pointless.
+const DefaultTimeout = 30 * time.Second
+
 // Client represents the API client for Lambda functions
 type Client struct {
 	baseURL string
 	token   string
 	client  *http.Client
+	retry   RetryPolicy
+}
+
+// Option customizes a Client
+type Option func(*Client)
+
+// WithHTTPClient replaces the default http.Client
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) { c.client = client }
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) { c.retry = policy }
 }
 
 // NewClient creates a new API client
-func NewClient(baseURL, accessToken string) *Client {
-	return &Client{
+func NewClient(baseURL, accessToken string, opts ...Option) *Client {
+	c := &Client{
 		baseURL: baseURL,
 		token:   accessToken,
-		client:  &http.Client{},
+		client:  &http.Client{Timeout: DefaultTimeout},
+		retry:   DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// SecretMetadata is the descriptive information kept alongside a secret's
+// value, so others can tell what it is for and who to ask about it
+type SecretMetadata struct {
+	Description string            `json:"description,omitempty"`
+	OwnerTeam   string            `json:"owner_team,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	ExpiresAt   string            `json:"expires_at,omitempty"` // RFC 3339; empty if the secret doesn't expire
+	RotatedAt   string            `json:"rotated_at,omitempty"` // RFC 3339; when 'egg rotate' last replaced the value
+}
+
+// Merged returns m with put merged in the way PutEggRequest.Metadata is
+// applied. m is not modified.
+func (m SecretMetadata) Merged(put *SecretMetadata) SecretMetadata {
+	if put == nil {
+		return m
+	}
+	merged := SecretMetadata{
+		Description: cmp.Or(put.Description, m.Description),
+		OwnerTeam:   cmp.Or(put.OwnerTeam, m.OwnerTeam),
+		ExpiresAt:   cmp.Or(put.ExpiresAt, m.ExpiresAt),
+		RotatedAt:   cmp.Or(put.RotatedAt, m.RotatedAt),
+		Tags:        m.Tags,
 	}
+	if len(put.Tags) > 0 {
+		merged.Tags = make(map[string]string, len(m.Tags)+len(put.Tags))
+		maps.Copy(merged.Tags, m.Tags)
+		maps.Copy(merged.Tags, put.Tags)
+	}
+	return merged
 }
 
 // PutEggRequest represents the request body for storing a secret
 type PutEggRequest struct {
 	SecretID  string `json:"secret_id"`
 	Plaintext string `json:"plaintext"`
+	Note      string `json:"note,omitempty"` // Change note shown in the secret's history
+
+	// Metadata, if set, is merged into the secret's: non-empty fields
+	// replace the current ones and tags are added or overwritten. Nil keeps
+	// the current metadata.
+	Metadata *SecretMetadata `json:"metadata,omitempty"`
+
+	// IdempotencyKey, if set, is sent instead of a fresh key per call, so
+	// a write replayed after its response was lost is applied only once
+	IdempotencyKey string `json:"-"`
 }
 
 // GetEggResponse represents the response from getting a secret
@@ -38,87 +109,319 @@ type GetEggResponse struct {
 	SecretID  string `json:"secret_id"`
 	Plaintext string `json:"plaintext"`
 	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+	Version   int64  `json:"version,omitempty"` // Bumped on every write; 0 if the API doesn't report it
+	SecretMetadata
 }
 
-// GetEggsResponse represents the response containing multiple secrets
+// Revision identifies the revision of a secret, for detecting concurrent
+// changes. It is the version, or the last update or creation time if the
+// API doesn't report versions.
+func (r GetEggResponse) Revision() string {
+	return revision(r.Version, r.UpdatedAt, r.CreatedAt)
+}
+
+// GetEggsResponse represents one page of secrets
 type GetEggsResponse struct {
-	Eggs []GetEggResponse `json:"eggs"`
+	Eggs      []GetEggResponse `json:"eggs"`
+	NextToken string           `json:"next_token,omitempty"` // Empty on the last page
+}
+
+// EggMetadata describes a secret without its value
+type EggMetadata struct {
+	SecretID  string `json:"secret_id"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+	Version   int64  `json:"version,omitempty"`
+	Size      int    `json:"size"` // Plaintext length in bytes
+	SecretMetadata
+}
+
+// Revision identifies the revision of a secret, see GetEggResponse.Revision
+func (m EggMetadata) Revision() string {
+	return revision(m.Version, m.UpdatedAt, m.CreatedAt)
+}
+
+// revision implements Revision
+func revision(version int64, updatedAt, createdAt string) string {
+	if version > 0 {
+		return "v" + strconv.FormatInt(version, 10)
+	}
+	return cmp.Or(updatedAt, createdAt)
+}
+
+// ListEggsResponse represents one page of secret metadata
+type ListEggsResponse struct {
+	Eggs      []EggMetadata `json:"eggs"`
+	NextToken string        `json:"next_token,omitempty"` // Empty on the last page
 }
 
 // PutEgg stores a secret by calling POST /eggs endpoint
-// Note: owner is extracted from the JWT token by the Lambda function
-func (c *Client) PutEgg(owner, key, value string) error {
-	request := PutEggRequest{
-		SecretID:  key,
-		Plaintext: value,
+// Note: owner is extracted from the JWT token by the Lambda function.
+// Every call sends a fresh Idempotency-Key unless req.IdempotencyKey is
+// set, so retries of the same call cannot create duplicate history entries.
+func (c *Client) PutEgg(ctx context.Context, owner string, req PutEggRequest) error {
+	return c.putEgg(ctx, req, http.Header{})
+}
+
+// PutEggIfMatch stores a secret only if it is still at ifMatch.Version,
+// sending If-Match (or If-None-Match: * for a new secret). A 409 or 412 is
+// returned as a *ConflictError describing the server's copy.
+func (c *Client) PutEggIfMatch(ctx context.Context, owner string, req PutEggRequest, ifMatch Precondition) error {
+	header := http.Header{}
+	if ifMatch.Version > 0 {
+		header.Set("If-Match", strconv.Quote(strconv.FormatInt(ifMatch.Version, 10)))
+	} else {
+		header.Set("If-None-Match", "*")
 	}
 
+	err := c.putEgg(ctx, req, header)
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		conflict.SecretID = req.SecretID
+		conflict.Expected = ifMatch
+	}
+	return err
+}
+
+// putEgg sends POST /eggs with the given extra headers
+func (c *Client) putEgg(ctx context.Context, request PutEggRequest, header http.Header) error {
 	data, err := json.Marshal(request)
 	if err != nil {
 		return fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := c.doRequest("POST", "/eggs", bytes.NewBuffer(data))
+	idempotencyKey := request.IdempotencyKey
+	if idempotencyKey == "" {
+		if idempotencyKey, err = newIdempotencyKey(); err != nil {
+			return fmt.Errorf("failed to generate idempotency key: %w", err)
+		}
+	}
+	header.Set(IdempotencyKeyHeader, idempotencyKey)
+
+	req, err := c.doRequest(ctx, "POST", "/eggs", data, header)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	defer req.Body.Close()
 
+	if req.StatusCode == http.StatusConflict || req.StatusCode == http.StatusPreconditionFailed {
+		return newConflictError("put egg", req)
+	}
 	if req.StatusCode != http.StatusOK && req.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(req.Body)
-		return fmt.Errorf("failed to put egg (status %d) %s", req.StatusCode, body)
+		return newAPIError("put egg", req)
 	}
 
 	return nil
 }
 
-// GetEgg retrieves all secrets for an owner
-func (c *Client) GetEgg(owner string) ([]GetEggResponse, error) {
-	resp, err := c.doRequest("GET", fmt.Sprintf("/eggs/%s", owner), nil)
+// GetEgg retrieves all secrets for an owner. It holds the whole vault in
+// memory; use AllEggs to stream large vaults page by page instead.
+func (c *Client) GetEgg(ctx context.Context, owner string) ([]GetEggResponse, error) {
+	var eggs []GetEggResponse
+	for egg, err := range c.AllEggs(ctx, owner) {
+		if err != nil {
+			return nil, err
+		}
+		eggs = append(eggs, egg)
+	}
+	return eggs, nil
+}
+
+// GetEggPage retrieves one page of decrypted secrets. Pass the NextToken
+// of the previous page, or "" for the first page.
+func (c *Client) GetEggPage(ctx context.Context, owner, pageToken string) (*GetEggsResponse, error) {
+	page, _, err := c.fetchEggPage(ctx, owner, pageToken, nil)
+	return page, err
+}
+
+// FetchSnapshot downloads the whole vault. When etag is set it is sent as
+// If-None-Match with the first page, and ErrNotModified is returned if the
+// API answers 304, so an unchanged vault costs one request and no decrypts.
+func (c *Client) FetchSnapshot(ctx context.Context, owner, etag string) (*VaultSnapshot, error) {
+	snapshot := &VaultSnapshot{Eggs: []GetEggResponse{}}
+	first := true
+
+	pages := paginate(func(token string) ([]GetEggResponse, string, error) {
+		header := http.Header{}
+		if first && etag != "" {
+			header.Set("If-None-Match", etag)
+		}
+		page, pageETag, err := c.fetchEggPage(ctx, owner, token, header)
+		if err != nil {
+			return nil, "", err
+		}
+		if first {
+			snapshot.ETag = pageETag
+			first = false
+		}
+		return page.Eggs, page.NextToken, nil
+	})
+
+	for egg, err := range pages {
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Eggs = append(snapshot.Eggs, egg)
+	}
+	return snapshot, nil
+}
+
+// fetchEggPage retrieves one page of secrets along with the response ETag
+func (c *Client) fetchEggPage(ctx context.Context, owner, pageToken string, header http.Header) (*GetEggsResponse, string, error) {
+	resp, err := c.doRequest(ctx, "GET", eggPath("eggs", owner)+pageQuery(nil, pageToken), nil, header)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, "", ErrNotModified
+	}
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to get egg (status %d) %s", resp.StatusCode, body)
+		return nil, "", newAPIError("get egg", resp)
 	}
 
 	var response GetEggsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &response, resp.Header.Get("ETag"), nil
+}
+
+// GetEggByKey retrieves and decrypts a single secret
+func (c *Client) GetEggByKey(ctx context.Context, owner, secretID string) (*GetEggResponse, error) {
+	resp, err := c.doRequest(ctx, "GET", eggPath("eggs", owner, secretID), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(fmt.Sprintf("get egg %q", secretID), resp)
+	}
+
+	var response GetEggResponse
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return response.Eggs, nil
+	return &response, nil
+}
+
+// GetEggsByKeys retrieves the given secrets, a few at a time, in the order
+// requested. If any key fails, the returned error joins every failure.
+func (c *Client) GetEggsByKeys(ctx context.Context, owner string, secretIDs []string) ([]GetEggResponse, error) {
+	eggs := make([]GetEggResponse, len(secretIDs))
+	errs := forEachBounded(ctx, len(secretIDs), DefaultConcurrency, func(ctx context.Context, i int) error {
+		egg, err := c.GetEggByKey(ctx, owner, secretIDs[i])
+		if err != nil {
+			return err
+		}
+		eggs[i] = *egg
+		return nil
+	})
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return eggs, nil
 }
 
 // BreakEgg deletes a specific secret
-func (c *Client) BreakEgg(owner, secretID string) error {
-	resp, err := c.doRequest("DELETE", fmt.Sprintf("/eggs/%s/%s", owner, secretID), nil)
+func (c *Client) BreakEgg(ctx context.Context, owner, secretID string) error {
+	return c.breakEgg(ctx, owner, secretID, nil)
+}
+
+// BreakEggIfMatch deletes a secret only if it is still at
+// ifMatch.Version, sending If-Match. A 409 or 412 is returned as a
+// *ConflictError describing the server's copy.
+func (c *Client) BreakEggIfMatch(ctx context.Context, owner, secretID string, ifMatch Precondition) error {
+	header := http.Header{}
+	header.Set("If-Match", strconv.Quote(strconv.FormatInt(ifMatch.Version, 10)))
+
+	err := c.breakEgg(ctx, owner, secretID, header)
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		conflict.SecretID = secretID
+		conflict.Expected = ifMatch
+	}
+	return err
+}
+
+// breakEgg sends DELETE /eggs/{owner}/{key} with the given extra headers
+func (c *Client) breakEgg(ctx context.Context, owner, secretID string, header http.Header) error {
+	resp, err := c.doRequest(ctx, "DELETE", eggPath("eggs", owner, secretID), nil, header)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusConflict || resp.StatusCode == http.StatusPreconditionFailed {
+		return newConflictError("break egg", resp)
+	}
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to break egg (status %d) %s", resp.StatusCode, body)
+		return newAPIError("break egg", resp)
 	}
 
 	return nil
 }
 
-// TODO (Optional for EC-14): Implement ListEggs
-// Should call GET /eggs endpoint to list all secrets for a user
-// You may need to add a new Lambda function for this
-func (c *Client) ListEggs(owner string) (map[string]string, error) {
-	// TODO:
-	// This might require a new Lambda function that scans DynamoDB for all eggs belonging to owner
-	// For now, return not implemented
+// ListEggs returns the key names and metadata of every secret an owner has,
+// without decrypting or transferring any values
+func (c *Client) ListEggs(ctx context.Context, owner string) ([]EggMetadata, error) {
+	var eggs []EggMetadata
+	for egg, err := range c.AllEggMetadata(ctx, owner) {
+		if err != nil {
+			return nil, err
+		}
+		eggs = append(eggs, egg)
+	}
+	return eggs, nil
+}
 
-	return nil, fmt.Errorf("not implemented - may need new Lambda endpoint")
+// GetEggMetadata returns one secret's metadata without decrypting its value
+func (c *Client) GetEggMetadata(ctx context.Context, owner, secretID string) (*EggMetadata, error) {
+	query := url.Values{"view": {"metadata"}}
+	resp, err := c.doRequest(ctx, "GET", eggPath("eggs", owner, secretID)+"?"+query.Encode(), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(fmt.Sprintf("get metadata for %q", secretID), resp)
+	}
+
+	var response EggMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &response, nil
+}
+
+// ListEggsPage retrieves one page of secret metadata
+func (c *Client) ListEggsPage(ctx context.Context, owner, pageToken string) (*ListEggsResponse, error) {
+	query := url.Values{"view": {"metadata"}}
+	resp, err := c.doRequest(ctx, "GET", eggPath("eggs", owner)+pageQuery(query, pageToken), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError("list eggs", resp)
+	}
+
+	var response ListEggsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &response, nil
 }
 
 // Should decode JWT and extract the 'sub' claim (user ID)
@@ -150,21 +453,43 @@ func ExtractOwnerFromToken(accessToken string) (string, error) {
 	return claims.Sub, nil
 }
 
-// function to make authenticated requests
-func (c *Client) doRequest(method, path string, body io.Reader) (*http.Response, error) {
+// function to make authenticated requests, retried according to c.retry
+func (c *Client) doRequest(ctx context.Context, method, path string, body []byte, header http.Header) (*http.Response, error) {
 	url := c.baseURL + path
-	req, err := http.NewRequest(method, url, body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+	for attempt := 1; ; attempt++ {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := c.client.Do(req)
+		retryable := canRetry(req) && attempt < c.retry.MaxAttempts && ctx.Err() == nil
+		if err != nil {
+			if !retryable {
+				return nil, fmt.Errorf("request failed: %w", err)
+			}
+		} else if !retryable || !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+
+		delay := c.retry.backoff(attempt, resp)
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return nil, fmt.Errorf("request failed: %w", err)
+		}
 	}
-
-	return resp, nil
 }
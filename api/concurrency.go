@@ -0,0 +1,42 @@
+package api
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultConcurrency bounds parallel requests made by the multi-item helpers.
+// It is kept low so a large batch doesn't trip API Gateway throttling.
+const DefaultConcurrency = 4
+
+// forEachBounded calls fn for every index in [0, n) with at most limit calls
+// in flight, and returns the error from each call by index. Calls that have
+// not started when ctx is cancelled report ctx.Err().
+func forEachBounded(ctx context.Context, n, limit int, fn func(ctx context.Context, i int) error) []error {
+	if limit <= 0 {
+		limit = DefaultConcurrency
+	}
+
+	errs := make([]error, n)
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+
+	for i := range n {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = fn(ctx, i)
+		}()
+	}
+
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Sentinel errors for each class of API failure. Every *APIError unwraps to
+// exactly one of them, so callers can use errors.Is(err, api.ErrNotFound).
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrConflict     = errors.New("conflict")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrValidation   = errors.New("invalid request")
+	ErrServer       = errors.New("server error")
+)
+
+// IsUnavailable reports whether err means the API could not be reached or
+// failed on its side, as opposed to rejecting the request. Reads may then
+// fall back to a local copy of the vault.
+//
+// Only server errors, timeouts and failures to resolve or connect count. A
+// certificate the client doesn't trust is a configuration problem, and
+// hiding it behind a local copy would make it easy to miss.
+func IsUnavailable(err error) bool {
+	var (
+		opErr        *net.OpError
+		dnsErr       *net.DNSError
+		netErr       net.Error
+		verifyErr    *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+
+	switch {
+	case err == nil, errors.Is(err, context.Canceled):
+		return false
+	case errors.As(err, &verifyErr), errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return false
+	case errors.Is(err, ErrServer), errors.Is(err, context.DeadlineExceeded):
+		return true
+	case errors.As(err, &dnsErr):
+		return true
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return true
+	}
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// ErrNotModified is returned by conditional reads when the copy the caller
+// already holds is still current. It is a signal, not a failure.
+var ErrNotModified = errors.New("not modified")
+
+// APIError describes a non-success response from the EggCarton API
+type APIError struct {
+	Op         string // What the client was doing, e.g. "put egg"
+	StatusCode int
+	Code       string // Machine-readable error code from the body, if any
+	Message    string // Human-readable message from the body
+	RequestID  string // API Gateway request ID, useful for support
+}
+
+// Error implements error
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "failed to %s: ", e.Op)
+	if kind := e.kind(); kind != nil {
+		fmt.Fprintf(&b, "%s: ", kind)
+	}
+	if e.Message != "" {
+		b.WriteString(e.Message)
+		b.WriteString(" ")
+	}
+	fmt.Fprintf(&b, "(status %d", e.StatusCode)
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, ", request %s", e.RequestID)
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// Unwrap returns the sentinel matching the status code
+func (e *APIError) Unwrap() error {
+	return e.kind()
+}
+
+// kind maps the HTTP status onto one of the sentinel errors
+func (e *APIError) kind() error {
+	switch {
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusForbidden:
+		return ErrForbidden
+	case e.StatusCode == http.StatusConflict || e.StatusCode == http.StatusPreconditionFailed:
+		return ErrConflict
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity ||
+		e.StatusCode == http.StatusRequestEntityTooLarge:
+		return ErrValidation
+	case e.StatusCode >= 500:
+		return ErrServer
+	}
+	return nil
+}
+
+// maxErrorBody bounds how much of an error body is read and shown
+const maxErrorBody = 4 << 10
+
+// newAPIError builds an *APIError from a failed response. It understands
+// both the Lambda's {"error": ..., "code": ...} bodies and API Gateway's
+// {"message": ...} bodies, and falls back to the raw text otherwise.
+func newAPIError(op string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+
+	apiErr := &APIError{
+		Op:         op,
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("X-Amzn-Requestid"),
+	}
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = resp.Header.Get("X-Request-Id")
+	}
+
+	var parsed struct {
+		Error   any    `json:"error"`
+		Message string `json:"message"`
+		Code    string `json:"code"`
+	}
+	if err := json.Unmarshal(body, &parsed); err == nil {
+		apiErr.Code = parsed.Code
+		apiErr.Message = parsed.Message
+		if msg, ok := parsed.Error.(string); ok && msg != "" {
+			if apiErr.Message == "" {
+				apiErr.Message = msg
+			} else if apiErr.Code == "" {
+				apiErr.Code = msg
+			}
+		}
+	} else {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+
+	return apiErr
+}
+
+// ConflictError is returned by conditional writes when the secret changed
+// since the caller read it. It unwraps to the *APIError, and so matches
+// ErrConflict.
+type ConflictError struct {
+	SecretID string
+	Expected Precondition // What the caller read
+
+	// The server's copy, if the response described it. Both are empty if
+	// it did not, which is also how some servers report a deleted secret.
+	CurrentVersion   int64
+	CurrentUpdatedAt string
+
+	Err *APIError
+}
+
+// Error implements error
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: %s changed since you read it (yours: %s; now: %s)",
+		ErrConflict, e.SecretID, cmp.Or(describeCopy(e.Expected.Version, e.Expected.UpdatedAt), "no such secret"), cmp.Or(describeCopy(e.CurrentVersion, e.CurrentUpdatedAt), "unknown"))
+}
+
+// Unwrap returns the underlying API error
+func (e *ConflictError) Unwrap() error {
+	return e.Err
+}
+
+// describeCopy renders one side of a conflict, or "" if nothing is known
+// about it
+func describeCopy(version int64, updatedAt string) string {
+	switch {
+	case version == 0 && updatedAt == "":
+		return ""
+	case version == 0:
+		return "updated " + updatedAt
+	case updatedAt == "":
+		return fmt.Sprintf("version %d", version)
+	}
+	return fmt.Sprintf("version %d, updated %s", version, updatedAt)
+}
+
+// newConflictError builds a *ConflictError from a 409 or 412 response,
+// whose body may describe the server's copy as {"current": {...}}
+func newConflictError(op string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	conflict := &ConflictError{Err: newAPIError(op, resp).(*APIError)}
+	var parsed struct {
+		Current *EggMetadata `json:"current"`
+	}
+	if json.Unmarshal(body, &parsed) == nil && parsed.Current != nil {
+		conflict.CurrentVersion = parsed.Current.Version
+		conflict.CurrentUpdatedAt = cmp.Or(parsed.Current.UpdatedAt, parsed.Current.CreatedAt)
+	}
+	return conflict
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// EggVersion is one entry in a secret's history
+type EggVersion struct {
+	Version   int64  `json:"version"`
+	WrittenAt string `json:"written_at"`
+	Author    string `json:"author,omitempty"` // Who wrote this version, as the API identifies them
+	Note      string `json:"note,omitempty"`   // Change note given with 'egg lay -m'
+	Size      int    `json:"size"`             // Plaintext length in bytes
+	Plaintext string `json:"plaintext,omitempty"`
+}
+
+// EggVersionsResponse represents one page of a secret's history
+type EggVersionsResponse struct {
+	Versions  []EggVersion `json:"versions"`
+	NextToken string       `json:"next_token,omitempty"` // Empty on the last page
+}
+
+// EggHistory streams a secret's versions, newest first. Values are only
+// transferred if withValues is set.
+func (c *Client) EggHistory(ctx context.Context, owner, secretID string, withValues bool) iter.Seq2[EggVersion, error] {
+	return paginate(func(token string) ([]EggVersion, string, error) {
+		page, err := c.EggHistoryPage(ctx, owner, secretID, withValues, token)
+		if err != nil {
+			return nil, "", err
+		}
+		return page.Versions, page.NextToken, nil
+	})
+}
+
+// EggHistoryPage retrieves one page of a secret's history
+func (c *Client) EggHistoryPage(ctx context.Context, owner, secretID string, withValues bool, pageToken string) (*EggVersionsResponse, error) {
+	query := url.Values{}
+	if withValues {
+		query.Set("view", "full")
+	}
+	resp, err := c.doRequest(ctx, "GET", eggPath("eggs", owner, secretID, "versions")+pageQuery(query, pageToken), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(fmt.Sprintf("get history of %q", secretID), resp)
+	}
+
+	var response EggVersionsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &response, nil
+}
+
+// GetEggVersion retrieves and decrypts one earlier version of a secret
+func (c *Client) GetEggVersion(ctx context.Context, owner, secretID string, version int64) (*GetEggResponse, error) {
+	query := url.Values{"version": {strconv.FormatInt(version, 10)}}
+	resp, err := c.doRequest(ctx, "GET", eggPath("eggs", owner, secretID)+"?"+query.Encode(), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(fmt.Sprintf("get version %d of %q", version, secretID), resp)
+	}
+
+	var response GetEggResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &response, nil
+}
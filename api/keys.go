@@ -0,0 +1,171 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// MaxSecretKeyLength is the longest secret key the API accepts
+const MaxSecretKeyLength = 128
+
+// Secret keys become environment variable names in 'egg hatch', so the
+// grammar is the portable POSIX one: a letter or underscore followed by
+// letters, digits and underscores.
+var secretKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reservedSecretKeys would break or hijack the process 'egg hatch' starts.
+// They are compared case-insensitively because hatch uppercases keys.
+var reservedSecretKeys = map[string]bool{
+	"PATH":                  true,
+	"HOME":                  true,
+	"USER":                  true,
+	"SHELL":                 true,
+	"PWD":                   true,
+	"IFS":                   true,
+	"TERM":                  true,
+	"LD_PRELOAD":            true,
+	"LD_LIBRARY_PATH":       true,
+	"DYLD_INSERT_LIBRARIES": true,
+	"DYLD_LIBRARY_PATH":     true,
+}
+
+// reservedSecretKeyPrefix is kept for the CLI's own settings (EGG_HOME, ...)
+const reservedSecretKeyPrefix = "EGG_"
+
+// InvalidKeyError explains why a secret key was rejected and suggests a
+// valid alternative. It matches ErrValidation with errors.Is.
+type InvalidKeyError struct {
+	Key        string
+	Reason     string
+	Suggestion string // Empty if no sensible alternative exists
+}
+
+// Error implements error
+func (e *InvalidKeyError) Error() string {
+	msg := fmt.Sprintf("invalid secret key %q: %s", e.Key, e.Reason)
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf(" (try %q)", e.Suggestion)
+	}
+	return msg
+}
+
+// Unwrap makes invalid keys count as validation errors
+func (e *InvalidKeyError) Unwrap() error {
+	return ErrValidation
+}
+
+// ValidateSecretKey checks key against the secret key grammar
+func ValidateSecretKey(key string) error {
+	invalid := func(reason string) error {
+		return &InvalidKeyError{Key: key, Reason: reason, Suggestion: SuggestSecretKey(key)}
+	}
+
+	switch {
+	case key == "":
+		return &InvalidKeyError{Key: key, Reason: "must not be empty"}
+	case len(key) > MaxSecretKeyLength:
+		return invalid(fmt.Sprintf("longer than %d characters", MaxSecretKeyLength))
+	case !secretKeyPattern.MatchString(key):
+		if key[0] >= '0' && key[0] <= '9' {
+			return invalid("must start with a letter or underscore")
+		}
+		for _, r := range key {
+			if !(r == '_' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9') {
+				return invalid(fmt.Sprintf("contains %q; only letters, digits and '_' are allowed", r))
+			}
+		}
+	case reservedSecretKeys[strings.ToUpper(key)]:
+		return invalid("is reserved because 'egg hatch' would override it in the environment")
+	case strings.HasPrefix(strings.ToUpper(key), reservedSecretKeyPrefix):
+		return invalid(fmt.Sprintf("the %s prefix is reserved for egg's own settings", reservedSecretKeyPrefix))
+	}
+	return nil
+}
+
+// SuggestSecretKey turns an arbitrary string into a valid secret key, e.g.
+// "stripe secret-key" into "stripe_secret_key"
+func SuggestSecretKey(key string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range key {
+		if ascii, ok := latinFold[unicode.ToLower(r)]; ok {
+			if unicode.IsUpper(r) {
+				ascii = strings.ToUpper(ascii)
+			}
+			b.WriteString(ascii)
+			underscore = false
+			continue
+		}
+		if r == '_' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+			underscore = r == '_'
+			continue
+		}
+		// Collapse runs of invalid characters into one underscore
+		if !underscore {
+			b.WriteByte('_')
+			underscore = true
+		}
+	}
+
+	suggestion := strings.Trim(b.String(), "_")
+	if suggestion == "" {
+		return ""
+	}
+	if suggestion[0] >= '0' && suggestion[0] <= '9' {
+		suggestion = "_" + suggestion
+	}
+	upper := strings.ToUpper(suggestion)
+	if reservedSecretKeys[upper] || strings.HasPrefix(upper, reservedSecretKeyPrefix) {
+		suggestion = "APP_" + suggestion
+	}
+	if len(suggestion) > MaxSecretKeyLength {
+		suggestion = suggestion[:MaxSecretKeyLength]
+	}
+	return suggestion
+}
+
+// latinFold spells common accented Latin letters in ASCII for suggestions
+var latinFold = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'æ': "ae",
+	'ç': "c", 'è': "e", 'é': "e", 'ê': "e", 'ë': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ñ': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ý': "y", 'ÿ': "y", 'ß': "ss",
+}
+
+// eggPath builds an API path from raw segments, escaping each one so keys
+// containing '/', '?', '#', spaces or unicode address the right resource
+func eggPath(segments ...string) string {
+	var b strings.Builder
+	for _, segment := range segments {
+		b.WriteByte('/')
+		b.WriteString(escapePathSegment(segment))
+	}
+	return b.String()
+}
+
+// escapePathSegment escapes everything outside the RFC 3986 unreserved set.
+// url.PathEscape leaves sub-delimiters such as '+' and ';' alone, which some
+// gateways decode or treat specially.
+func escapePathSegment(segment string) string {
+	// "." and ".." would be collapsed by path normalization along the way
+	dotSegment := segment == "." || segment == ".."
+
+	var b strings.Builder
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		if dotSegment {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// MetadataPatch changes a secret's metadata without touching its value.
+// Nil fields are left alone; a pointer to "" clears the field.
+type MetadataPatch struct {
+	Description *string           `json:"description,omitempty"`
+	OwnerTeam   *string           `json:"owner_team,omitempty"`
+	ExpiresAt   *string           `json:"expires_at,omitempty"`
+	SetTags     map[string]string `json:"set_tags,omitempty"`    // Added or overwritten
+	RemoveTags  []string          `json:"remove_tags,omitempty"` // Removed if present
+}
+
+// HasTags reports whether every tag in filter is set to the same value.
+// An empty filter value only requires the tag to be present.
+func (m SecretMetadata) HasTags(filter map[string]string) bool {
+	for k, want := range filter {
+		got, ok := m.Tags[k]
+		if !ok || (want != "" && got != want) {
+			return false
+		}
+	}
+	return true
+}
+
+// UpdateEggMetadata applies patch to a secret's metadata and returns the
+// result. The secret's value and version are unchanged.
+func (c *Client) UpdateEggMetadata(ctx context.Context, owner, secretID string, patch MetadataPatch) (*EggMetadata, error) {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := c.doRequest(ctx, "PATCH", eggPath("eggs", owner, secretID, "metadata"), data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(fmt.Sprintf("update metadata of %q", secretID), resp)
+	}
+
+	var response EggMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &response, nil
+}
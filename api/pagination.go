@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/url"
+)
+
+// PageTokenParam is the query parameter carrying a page's NextToken. The API
+// pages its results to stay under DynamoDB query and Lambda response limits.
+const PageTokenParam = "next_token"
+
+// AllEggs streams every secret an owner has, fetching one page at a time
+// only as the caller asks for more, so memory use is bounded by the page
+// size rather than the vault size. Iteration stops after the first error.
+//
+//	for egg, err := range client.AllEggs(ctx, owner) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func (c *Client) AllEggs(ctx context.Context, owner string) iter.Seq2[GetEggResponse, error] {
+	return paginate(func(token string) ([]GetEggResponse, string, error) {
+		page, err := c.GetEggPage(ctx, owner, token)
+		if err != nil {
+			return nil, "", err
+		}
+		return page.Eggs, page.NextToken, nil
+	})
+}
+
+// AllEggMetadata streams the metadata of every secret, page by page
+func (c *Client) AllEggMetadata(ctx context.Context, owner string) iter.Seq2[EggMetadata, error] {
+	return paginate(func(token string) ([]EggMetadata, string, error) {
+		page, err := c.ListEggsPage(ctx, owner, token)
+		if err != nil {
+			return nil, "", err
+		}
+		return page.Eggs, page.NextToken, nil
+	})
+}
+
+// paginate turns a page fetcher into a lazy iterator over every item
+func paginate[T any](fetch func(token string) ([]T, string, error)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		seen := map[string]bool{}
+		token := ""
+
+		for {
+			items, next, err := fetch(token)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+
+			if next == "" {
+				return
+			}
+			// A server bug that repeats a token would otherwise loop forever
+			if seen[next] {
+				yield(zero, fmt.Errorf("pagination loop: page token %q repeated", next))
+				return
+			}
+			seen[next] = true
+			token = next
+		}
+	}
+}
+
+// pageQuery appends the page token to query and encodes it as "?..."
+func pageQuery(query url.Values, pageToken string) string {
+	if query == nil {
+		query = url.Values{}
+	}
+	if pageToken != "" {
+		query.Set(PageTokenParam, pageToken)
+	}
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
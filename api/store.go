@@ -0,0 +1,202 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store is the secret storage backend the CLI's commands talk to. *Client,
+// which calls the EggCarton Lambda API, is the standard implementation;
+// others can be plugged in with RegisterBackend.
+type Store interface {
+	// PutEgg creates or replaces a secret, creating a new version
+	PutEgg(ctx context.Context, owner string, req PutEggRequest) error
+
+	// GetEggByKey returns one decrypted secret, or an error matching ErrNotFound
+	GetEggByKey(ctx context.Context, owner, secretID string) (*GetEggResponse, error)
+
+	// GetEggsByKeys returns the given secrets in the order requested
+	GetEggsByKeys(ctx context.Context, owner string, secretIDs []string) ([]GetEggResponse, error)
+
+	// AllEggs streams every decrypted secret
+	AllEggs(ctx context.Context, owner string) iter.Seq2[GetEggResponse, error]
+
+	// AllEggMetadata streams the metadata of every secret, without values
+	AllEggMetadata(ctx context.Context, owner string) iter.Seq2[EggMetadata, error]
+
+	// GetEggMetadata returns one secret's metadata without its value
+	GetEggMetadata(ctx context.Context, owner, secretID string) (*EggMetadata, error)
+
+	// BreakEgg deletes a secret. Backends with a trash (see TrashStore)
+	// keep it there until it is restored or purged.
+	BreakEgg(ctx context.Context, owner, secretID string) error
+}
+
+// VaultSnapshot is a complete copy of one owner's vault
+type VaultSnapshot struct {
+	ETag string // Identifies this version of the vault; empty if unsupported
+	Eggs []GetEggResponse
+}
+
+// SnapshotStore is implemented by backends that can tell whether a vault
+// changed since an earlier snapshot, so caches can revalidate cheaply
+type SnapshotStore interface {
+	Store
+
+	// FetchSnapshot returns every secret, or ErrNotModified if the vault
+	// still matches etag
+	FetchSnapshot(ctx context.Context, owner, etag string) (*VaultSnapshot, error)
+}
+
+var _ SnapshotStore = (*Client)(nil)
+
+// Precondition makes a write conditional on the secret being unchanged
+// since the caller read it
+type Precondition struct {
+	Version   int64  // The version read; 0 means the secret must not exist yet
+	UpdatedAt string // When that version was written, for error messages; optional
+}
+
+// ConditionalStore is implemented by backends that can reject a write when
+// the secret has changed since it was read, so concurrent edits are not
+// silently lost
+type ConditionalStore interface {
+	Store
+
+	// PutEggIfMatch stores a secret only if it still matches ifMatch, and
+	// otherwise returns a *ConflictError
+	PutEggIfMatch(ctx context.Context, owner string, req PutEggRequest, ifMatch Precondition) error
+
+	// BreakEggIfMatch deletes a secret only if it is still at
+	// ifMatch.Version, and otherwise returns a *ConflictError
+	BreakEggIfMatch(ctx context.Context, owner, secretID string, ifMatch Precondition) error
+}
+
+var _ ConditionalStore = (*Client)(nil)
+
+// HistoryStore is implemented by backends that keep earlier versions of
+// each secret
+type HistoryStore interface {
+	Store
+
+	// EggHistory streams a secret's versions, newest first, with their
+	// values only if withValues is set
+	EggHistory(ctx context.Context, owner, secretID string, withValues bool) iter.Seq2[EggVersion, error]
+
+	// GetEggVersion returns one version of a secret, or an error matching
+	// ErrNotFound if the secret or version doesn't exist
+	GetEggVersion(ctx context.Context, owner, secretID string, version int64) (*GetEggResponse, error)
+}
+
+var _ HistoryStore = (*Client)(nil)
+
+// TrashStore is implemented by backends whose BreakEgg can be a soft
+// delete: deleted secrets stay in a trash for a retention window set by the
+// backend. Whether it is depends on the server, see TrashRetention.
+type TrashStore interface {
+	Store
+
+	// TrashRetention returns how long deleted secrets stay in the trash, or
+	// 0 if the server deletes them for good
+	TrashRetention(ctx context.Context, owner string) (time.Duration, error)
+
+	// AllTrash streams the secrets in the trash
+	AllTrash(ctx context.Context, owner string) iter.Seq2[TrashedEgg, error]
+
+	// RestoreEgg moves a secret out of the trash, or returns an error
+	// matching ErrConflict if the key is in use again
+	RestoreEgg(ctx context.Context, owner, secretID string) error
+
+	// PurgeEgg permanently deletes a secret, live or in the trash
+	PurgeEgg(ctx context.Context, owner, secretID string) error
+}
+
+var _ TrashStore = (*Client)(nil)
+
+// MetadataStore is implemented by backends that can change a secret's
+// metadata without writing a new version of its value
+type MetadataStore interface {
+	Store
+
+	// UpdateEggMetadata applies patch and returns the resulting metadata
+	UpdateEggMetadata(ctx context.Context, owner, secretID string, patch MetadataPatch) (*EggMetadata, error)
+}
+
+var _ MetadataStore = (*Client)(nil)
+
+// DefaultBackend is the backend used when a profile doesn't name one
+const DefaultBackend = "http"
+
+// BackendOptions is what a backend is opened with
+type BackendOptions struct {
+	Endpoint    string            // The profile's api_endpoint
+	AccessToken string            // The logged-in user's access token
+	Settings    map[string]string // The profile's backend_settings, backend-specific
+	HTTPClient  *http.Client      // Shared HTTP client; nil for the default
+	RetryPolicy RetryPolicy
+}
+
+// BackendFactory opens a Store
+type BackendFactory func(opts BackendOptions) (Store, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]BackendFactory{}
+)
+
+func init() {
+	RegisterBackend(DefaultBackend, func(opts BackendOptions) (Store, error) {
+		clientOpts := []Option{WithRetryPolicy(opts.RetryPolicy)}
+		if opts.HTTPClient != nil {
+			clientOpts = append(clientOpts, WithHTTPClient(opts.HTTPClient))
+		}
+		return NewClient(opts.Endpoint, opts.AccessToken, clientOpts...), nil
+	})
+}
+
+// RegisterBackend makes a backend available by name to OpenStore. It is
+// meant to be called from an init function and panics on duplicates.
+func RegisterBackend(name string, factory BackendFactory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	if _, dup := backends[name]; dup {
+		panic(fmt.Sprintf("api: backend %q registered twice", name))
+	}
+	backends[name] = factory
+}
+
+// OpenStore opens the named backend ("" means DefaultBackend)
+func OpenStore(name string, opts BackendOptions) (Store, error) {
+	if name == "" {
+		name = DefaultBackend
+	}
+
+	backendsMu.RLock()
+	factory, ok := backends[name]
+	backendsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q (available: %s)", name, strings.Join(Backends(), ", "))
+	}
+	return factory(opts)
+}
+
+// Backends lists the registered backend names
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
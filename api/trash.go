@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TrashedEgg describes a deleted secret that can still be restored
+type TrashedEgg struct {
+	SecretID  string `json:"secret_id"`
+	DeletedAt string `json:"deleted_at"`
+	PurgeAt   string `json:"purge_at,omitempty"` // When the API deletes it for good
+	Version   int64  `json:"version,omitempty"`  // The version it had when deleted
+	Size      int    `json:"size"`
+}
+
+// TrashResponse represents one page of the trash
+type TrashResponse struct {
+	Eggs      []TrashedEgg `json:"eggs"`
+	NextToken string       `json:"next_token,omitempty"` // Empty on the last page
+
+	// RetentionSeconds is how long the API keeps deleted secrets. An API
+	// that deletes for good doesn't report it.
+	RetentionSeconds int64 `json:"retention_seconds,omitempty"`
+}
+
+// AllTrash streams every secret in an owner's trash, page by page
+func (c *Client) AllTrash(ctx context.Context, owner string) iter.Seq2[TrashedEgg, error] {
+	return paginate(func(token string) ([]TrashedEgg, string, error) {
+		page, err := c.TrashPage(ctx, owner, token)
+		if err != nil {
+			return nil, "", err
+		}
+		return page.Eggs, page.NextToken, nil
+	})
+}
+
+// TrashPage retrieves one page of the trash
+func (c *Client) TrashPage(ctx context.Context, owner, pageToken string) (*TrashResponse, error) {
+	query := url.Values{"view": {"trash"}}
+	resp, err := c.doRequest(ctx, "GET", eggPath("eggs", owner)+pageQuery(query, pageToken), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError("list trash", resp)
+	}
+
+	var response TrashResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &response, nil
+}
+
+// TrashRetention asks the API how long it keeps deleted secrets. It returns
+// 0 if the API doesn't report a retention window, in which case BreakEgg
+// must be assumed to delete for good.
+func (c *Client) TrashRetention(ctx context.Context, owner string) (time.Duration, error) {
+	page, err := c.TrashPage(ctx, owner, "")
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(page.RetentionSeconds) * time.Second, nil
+}
+
+// RestoreEgg moves a secret out of the trash. It fails with ErrConflict if
+// a secret with the same key was stored since.
+func (c *Client) RestoreEgg(ctx context.Context, owner, secretID string) error {
+	resp, err := c.doRequest(ctx, "POST", eggPath("eggs", owner, secretID, "restore"), nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(fmt.Sprintf("restore egg %q", secretID), resp)
+	}
+
+	return nil
+}
+
+// PurgeEgg permanently deletes a secret, whether it is live or in the trash
+func (c *Client) PurgeEgg(ctx context.Context, owner, secretID string) error {
+	query := url.Values{"purge": {"true"}}
+	resp, err := c.doRequest(ctx, "DELETE", eggPath("eggs", owner, secretID)+"?"+query.Encode(), nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(fmt.Sprintf("purge egg %q", secretID), resp)
+	}
+
+	return nil
+}
@@ -77,7 +77,7 @@ func StartCallbackServer(ctx context.Context) (string, error) {
 	case <-ctx.Done():
 		// Timeout or cancellation
 		server.Close() // Force close
-		return "", fmt.Errorf("authentication timeout or cancelled")
+		return "", fmt.Errorf("authentication timeout or cancelled: %w", ctx.Err())
 	}
 
 	// Check if we got an error from OAuth
@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,6 +14,10 @@ import (
 	"github.com/owenHochwald/egg-carton/cli/config"
 )
 
+// ErrTokenRejected is returned when Cognito refuses a code or refresh token,
+// which means the user has to log in again
+var ErrTokenRejected = errors.New("token rejected")
+
 // TokenResponse represents the OAuth token response
 type TokenResponse struct {
 	AccessToken  string `json:"access_token"`
@@ -21,8 +27,9 @@ type TokenResponse struct {
 	TokenType    string `json:"token_type"`
 }
 
-// ExchangeCodeForTokens exchanges the authorization code for JWT tokens
-func ExchangeCodeForTokens(tokenURL, clientID, code, redirectURI, codeVerifier string) (*config.TokenData, error) {
+// ExchangeCodeForTokens exchanges the authorization code for JWT tokens.
+// A nil client uses a default one.
+func ExchangeCodeForTokens(ctx context.Context, client *http.Client, tokenURL, clientID, code, redirectURI, codeVerifier string) (*config.TokenData, error) {
 	// Build form data for token exchange
 	data := url.Values{}
 	data.Set("grant_type", "authorization_code")
@@ -32,7 +39,7 @@ func ExchangeCodeForTokens(tokenURL, clientID, code, redirectURI, codeVerifier s
 	data.Set("code_verifier", codeVerifier)
 
 	// Create POST request
-	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(data.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(data.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -40,8 +47,7 @@ func ExchangeCodeForTokens(tokenURL, clientID, code, redirectURI, codeVerifier s
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	// Execute request
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := tokenClient(client).Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to exchange code: %w", err)
 	}
@@ -55,7 +61,7 @@ func ExchangeCodeForTokens(tokenURL, clientID, code, redirectURI, codeVerifier s
 
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("token exchange failed (status %d): %s", resp.StatusCode, string(body))
+		return nil, tokenError("token exchange", resp.StatusCode, body)
 	}
 
 	// Parse JSON response
@@ -75,8 +81,9 @@ func ExchangeCodeForTokens(tokenURL, clientID, code, redirectURI, codeVerifier s
 	}, nil
 }
 
-// RefreshAccessToken refreshes an expired access token using the refresh token
-func RefreshAccessToken(tokenURL, clientID, refreshToken string) (*config.TokenData, error) {
+// RefreshAccessToken refreshes an expired access token using the refresh
+// token. A nil client uses a default one.
+func RefreshAccessToken(ctx context.Context, client *http.Client, tokenURL, clientID, refreshToken string) (*config.TokenData, error) {
 	// Build form data for token refresh
 	data := url.Values{}
 	data.Set("grant_type", "refresh_token")
@@ -84,7 +91,7 @@ func RefreshAccessToken(tokenURL, clientID, refreshToken string) (*config.TokenD
 	data.Set("refresh_token", refreshToken)
 
 	// Create POST request
-	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(data.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(data.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -92,8 +99,7 @@ func RefreshAccessToken(tokenURL, clientID, refreshToken string) (*config.TokenD
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	// Execute request
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := tokenClient(client).Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to refresh token: %w", err)
 	}
@@ -107,7 +113,7 @@ func RefreshAccessToken(tokenURL, clientID, refreshToken string) (*config.TokenD
 
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("token refresh failed (status %d): %s", resp.StatusCode, string(body))
+		return nil, tokenError("token refresh", resp.StatusCode, body)
 	}
 
 	// Parse JSON response
@@ -116,6 +122,11 @@ func RefreshAccessToken(tokenURL, clientID, refreshToken string) (*config.TokenD
 		return nil, fmt.Errorf("failed to parse token response: %w", err)
 	}
 
+	// Cognito does not rotate refresh tokens, so keep using the one we have
+	if tokenResp.RefreshToken == "" {
+		tokenResp.RefreshToken = refreshToken
+	}
+
 	// Convert to TokenData with issued timestamp
 	return &config.TokenData{
 		AccessToken:  tokenResp.AccessToken,
@@ -126,3 +137,20 @@ func RefreshAccessToken(tokenURL, clientID, refreshToken string) (*config.TokenD
 		IssuedAt:     time.Now().Unix(),
 	}, nil
 }
+
+// tokenClient returns client, or a default client when it is nil
+func tokenClient(client *http.Client) *http.Client {
+	if client == nil {
+		return &http.Client{Timeout: 10 * time.Second}
+	}
+	return client
+}
+
+// tokenError describes a failed token endpoint call. Cognito answers 400
+// (invalid_grant) or 401 when the code or refresh token is no longer good.
+func tokenError(op string, status int, body []byte) error {
+	if status == http.StatusBadRequest || status == http.StatusUnauthorized {
+		return fmt.Errorf("%s failed (status %d): %s: %w", op, status, string(body), ErrTokenRejected)
+	}
+	return fmt.Errorf("%s failed (status %d): %s", op, status, string(body))
+}
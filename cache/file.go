@@ -0,0 +1,209 @@
+// Package cache keeps an encrypted copy of a vault on disk, so that reads
+// such as 'egg get' and 'egg hatch' don't pay for a network round trip and
+// a KMS decrypt on every run, and an encrypted outbox of writes made while
+// offline.
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+	"github.com/owenHochwald/egg-carton/cli/config"
+)
+
+// KeySize is the length of a cache or outbox key (AES-256)
+const KeySize = 32
+
+// vaultFile is the name of the cached vault in a profile's cache directory
+const vaultFile = "vault.json"
+
+// schema describes the cache file envelope
+var schema = &config.Schema{
+	Name:       "vault cache",
+	Version:    1,
+	Migrations: map[int]config.MigrationFunc{},
+}
+
+// envelope is the on-disk format. Only the owner is stored in the clear.
+type envelope struct {
+	SchemaVersion int    `json:"schema_version"`
+	Owner         string `json:"owner"`
+	Nonce         []byte `json:"nonce"`
+	Ciphertext    []byte `json:"ciphertext"`
+}
+
+// Snapshot is the decrypted contents of a cache file
+type Snapshot struct {
+	ETag      string               `json:"etag,omitempty"`
+	FetchedAt time.Time            `json:"fetched_at"`      // When the API last confirmed the contents
+	Dirty     bool                 `json:"dirty,omitempty"` // Changed locally since, so revalidate before use
+	Eggs      []api.GetEggResponse `json:"eggs"`
+}
+
+// NewKey generates a random cache or outbox key
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return key, nil
+}
+
+// Dir returns the cache directory of a profile
+func Dir(profile string) (string, error) {
+	base, err := config.CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, profile), nil
+}
+
+// Path returns the cached vault file of a profile
+func Path(profile string) (string, error) {
+	dir, err := Dir(profile)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, vaultFile), nil
+}
+
+// Clear deletes a profile's cache
+func Clear(profile string) error {
+	dir, err := Dir(profile)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to clear cache: %w", err)
+	}
+	return nil
+}
+
+// ClearAll deletes the cache of every profile
+func ClearAll() error {
+	base, err := config.CacheDir()
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(base); err != nil {
+		return fmt.Errorf("failed to clear cache: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshot reads the cached vault at path without contacting the API. A
+// missing file yields fs.ErrNotExist.
+func LoadSnapshot(path, owner string, key []byte) (*Snapshot, error) {
+	return load(path, owner, key)
+}
+
+// load reads and decrypts a cache file. A missing file yields fs.ErrNotExist.
+func load(path, owner string, key []byte) (*Snapshot, error) {
+	var snapshot Snapshot
+	if err := readSealed(schema, path, owner, key, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// save encrypts snapshot and writes it atomically, readable only by the user
+func save(path, owner string, key []byte, snapshot *Snapshot) error {
+	return writeSealed(schema, path, owner, key, snapshot)
+}
+
+// readSealed reads a file written by writeSealed and decrypts it into v
+func readSealed(schema *config.Schema, path, owner string, key []byte, v any) error {
+	data, err := schema.Read(path)
+	if err != nil {
+		return err
+	}
+
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if env.Owner != owner {
+		return fmt.Errorf("%s belongs to another user", path)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	plaintext, err := aead.Open(nil, env.Nonce, env.Ciphertext, []byte(owner))
+	if err != nil {
+		// Usually a file written by a previous login, whose key is gone
+		return fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(plaintext, v); err != nil {
+		return fmt.Errorf("failed to parse decrypted %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeSealed encrypts v for owner and writes it atomically, readable only
+// by the user
+func writeSealed(schema *config.Schema, path, owner string, key []byte, v any) error {
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", schema.Name, err)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	data, err := json.Marshal(envelope{
+		SchemaVersion: schema.Version,
+		Owner:         owner,
+		Nonce:         nonce,
+		// The owner is authenticated so a file can't be replayed for someone else
+		Ciphertext: aead.Seal(nil, nonce, plaintext, []byte(owner)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", schema.Name, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create %s directory: %w", schema.Name, err)
+	}
+	if err := config.WriteFileAtomic(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", schema.Name, err)
+	}
+	return nil
+}
+
+// remove deletes a cache file, ignoring one that is already gone
+func remove(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// newAEAD returns AES-GCM keyed with key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
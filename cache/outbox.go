@@ -0,0 +1,383 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+	"github.com/owenHochwald/egg-carton/cli/config"
+)
+
+// outboxSchema describes the outbox file envelope
+var outboxSchema = &config.Schema{
+	Name:       "outbox",
+	Version:    1,
+	Migrations: map[int]config.MigrationFunc{},
+}
+
+// How long a writer waits for the outbox lock, and the age after which a
+// lock left behind by a crashed egg is broken
+const (
+	lockTimeout = 10 * time.Second
+	lockStale   = time.Minute
+)
+
+// ErrBlocked is reported for a queued write that waits on an earlier write
+// to the same secret that could not be pushed
+var ErrBlocked = errors.New("waiting for an earlier change to the same secret")
+
+// OpKind is what a queued write does
+type OpKind string
+
+const (
+	OpPut    OpKind = "lay"
+	OpDelete OpKind = "break"
+)
+
+// Op is a write made while offline
+type Op struct {
+	// ID identifies the write and is sent as its Idempotency-Key, so a
+	// write whose response was lost is applied once when pushed again
+	ID string `json:"id,omitempty"`
+
+	Kind      OpKind              `json:"kind"`
+	SecretID  string              `json:"secret_id"`
+	Plaintext string              `json:"plaintext,omitempty"`
+	Note      string              `json:"note,omitempty"`
+	Metadata  *api.SecretMetadata `json:"metadata,omitempty"`
+
+	// Base is the revision of the secret the write was made against (see
+	// api.GetEggResponse.Revision), empty if the secret didn't exist
+	Base     string    `json:"base,omitempty"`
+	QueuedAt time.Time `json:"queued_at"`
+}
+
+// PushResult is the outcome of replaying one queued write
+type PushResult struct {
+	Op  Op
+	Err error // nil once applied; matches api.ErrConflict or ErrBlocked if still queued
+}
+
+// outboxFile is the decrypted contents of an outbox file
+type outboxFile struct {
+	Ops []Op `json:"ops"`
+}
+
+// Outbox is the encrypted queue of writes made while offline. Unlike the
+// vault cache it is not disposable, so it lives in the state directory and
+// has a key of its own, which survives logging in again.
+type Outbox struct {
+	path  string
+	owner string
+	key   []byte
+}
+
+// OutboxPath returns the outbox file of a profile
+func OutboxPath(profile string) (string, error) {
+	dir, err := config.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, fmt.Sprintf("outbox-%s.json", profile)), nil
+}
+
+// OpenOutbox returns the outbox at path, encrypted for owner with key
+func OpenOutbox(path, owner string, key []byte) *Outbox {
+	return &Outbox{path: path, owner: owner, key: key}
+}
+
+// Pending returns the queued writes, oldest first
+func (o *Outbox) Pending() ([]Op, error) {
+	var file outboxFile
+	err := readSealed(outboxSchema, o.path, o.owner, o.key, &file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbox: %w", err)
+	}
+	return file.Ops, nil
+}
+
+// Add queues a write after those already pending, giving it an ID if it
+// has none
+func (o *Outbox) Add(op Op) error {
+	unlock, err := o.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	ops, err := o.Pending()
+	if err != nil {
+		return err
+	}
+	if op.ID == "" {
+		op.ID = rand.Text()
+	}
+	return o.replace(append(ops, op))
+}
+
+// Replace overwrites the queue, deleting the file once it is empty
+func (o *Outbox) Replace(ops []Op) error {
+	unlock, err := o.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return o.replace(ops)
+}
+
+// replace implements Replace; the caller holds the lock
+func (o *Outbox) replace(ops []Op) error {
+	if len(ops) == 0 {
+		if err := remove(o.path); err != nil {
+			return fmt.Errorf("failed to clear outbox: %w", err)
+		}
+		return nil
+	}
+	return writeSealed(outboxSchema, o.path, o.owner, o.key, outboxFile{Ops: ops})
+}
+
+// Push replays the queued writes against store in order. Each write is
+// applied only if the secret is still at the revision it was made against,
+// unless force is set. A write that fails stays queued, and so do later
+// writes to the same secret, so their order is kept.
+//
+// Push stops early when the API becomes unavailable; the error is returned
+// along with the results so far, and everything not applied stays queued.
+//
+// The lock is not held while pushing, so other egg runs can queue writes
+// meanwhile; they are kept after the writes still queued.
+func (o *Outbox) Push(ctx context.Context, store api.Store, force bool) ([]PushResult, error) {
+	ops, err := o.identify()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		results   []PushResult
+		remaining []Op
+		stopErr   error
+		blocked   = map[string]bool{} // Secrets with an earlier write still queued
+		pushed    = map[string]bool{} // Secrets whose version this push changed
+	)
+	for i, op := range ops {
+		if blocked[op.SecretID] {
+			results = append(results, PushResult{Op: op, Err: ErrBlocked})
+			remaining = append(remaining, op)
+			continue
+		}
+
+		err := apply(ctx, store, o.owner, op, !force && !pushed[op.SecretID])
+		if api.IsUnavailable(err) || errors.Is(err, context.Canceled) || errors.Is(err, ErrOffline) {
+			remaining = append(remaining, ops[i:]...)
+			stopErr = err
+			break
+		}
+		results = append(results, PushResult{Op: op, Err: err})
+		if err != nil {
+			blocked[op.SecretID] = true
+			remaining = append(remaining, op)
+			continue
+		}
+		pushed[op.SecretID] = true
+	}
+
+	if err := o.settle(ops, remaining); err != nil {
+		return results, err
+	}
+	return results, stopErr
+}
+
+// identify returns the queued writes after giving an ID to any queued by an
+// older egg without one
+func (o *Outbox) identify() ([]Op, error) {
+	unlock, err := o.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	ops, err := o.Pending()
+	if err != nil {
+		return nil, err
+	}
+	missing := false
+	for i := range ops {
+		if ops[i].ID == "" {
+			ops[i].ID = rand.Text()
+			missing = true
+		}
+	}
+	if missing {
+		if err := o.replace(ops); err != nil {
+			return nil, err
+		}
+	}
+	return ops, nil
+}
+
+// settle rewrites the queue after pushed was pushed: of those writes only
+// remaining stay, while writes queued since, or dropped since by another
+// egg, are left as they are
+func (o *Outbox) settle(pushed, remaining []Op) error {
+	unlock, err := o.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	ops, err := o.Pending()
+	if err != nil {
+		return err
+	}
+	wasPushed := make(map[string]bool, len(pushed))
+	for _, op := range pushed {
+		wasPushed[op.ID] = true
+	}
+	for _, op := range remaining {
+		wasPushed[op.ID] = false
+	}
+	kept := ops[:0]
+	for _, op := range ops {
+		if !wasPushed[op.ID] {
+			kept = append(kept, op)
+		}
+	}
+	return o.replace(kept)
+}
+
+// lock takes the outbox's lock file, so concurrent egg runs can't drop each
+// other's writes, and returns the function that releases it
+func (o *Outbox) lock() (func(), error) {
+	path := o.path + ".lock"
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("failed to lock outbox: %w", err)
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > lockStale {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("failed to lock outbox: %s is held by another egg; delete it if none is running", path)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// apply performs one queued write, first checking for a conflicting change
+// on the server if check is set
+func apply(ctx context.Context, store api.Store, owner string, op Op, check bool) error {
+	req := api.PutEggRequest{SecretID: op.SecretID, Plaintext: op.Plaintext, Note: op.Note, Metadata: op.Metadata, IdempotencyKey: op.ID}
+
+	// A write the backend can check is made conditional on the revision it
+	// was queued against, so a change made between checking and writing is
+	// not lost: a new secret must still not exist, and an existing one must
+	// still be at the queued version
+	if check {
+		if err := applyIfMatch(ctx, store, owner, req, op); !errors.Is(err, errors.ErrUnsupported) {
+			return err
+		}
+	}
+
+	if check {
+		current := ""
+		meta, err := store.GetEggMetadata(ctx, owner, op.SecretID)
+		switch {
+		case errors.Is(err, api.ErrNotFound):
+		case err != nil:
+			return err
+		default:
+			current = meta.Revision()
+		}
+
+		if current != op.Base {
+			if op.Kind == OpDelete && current == "" {
+				return nil // Someone else already deleted it
+			}
+			return fmt.Errorf("%w: %s changed on the server after this was queued (queued against %s, the server has %s)",
+				api.ErrConflict, op.SecretID, describeRevision(op.Base), describeRevision(current))
+		}
+	}
+
+	switch op.Kind {
+	case OpPut:
+		return store.PutEgg(ctx, owner, req)
+	case OpDelete:
+		if err := store.BreakEgg(ctx, owner, op.SecretID); err != nil && !errors.Is(err, api.ErrNotFound) {
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown queued change %q", op.Kind)
+}
+
+// applyIfMatch performs one queued write conditionally. It returns an error
+// matching errors.ErrUnsupported if the backend can't check versions, or
+// the write was queued against a timestamp rather than a version.
+func applyIfMatch(ctx context.Context, store api.Store, owner string, req api.PutEggRequest, op Op) error {
+	conditional, ok := store.(api.ConditionalStore)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	var ifMatch api.Precondition // Version 0 means the secret must not exist
+	if op.Base != "" {
+		if ifMatch.Version, ok = baseVersion(op.Base); !ok {
+			return errors.ErrUnsupported
+		}
+	}
+
+	switch op.Kind {
+	case OpPut:
+		return conditional.PutEggIfMatch(ctx, owner, req, ifMatch)
+	case OpDelete:
+		if ifMatch.Version == 0 {
+			return errors.ErrUnsupported
+		}
+		err := conditional.BreakEggIfMatch(ctx, owner, op.SecretID, ifMatch)
+		if errors.Is(err, api.ErrNotFound) {
+			return nil // Someone else already deleted it
+		}
+		return err
+	}
+	return errors.ErrUnsupported
+}
+
+// baseVersion returns the version a revision names, if it names one (see
+// api.EggMetadata.Revision)
+func baseVersion(revision string) (int64, bool) {
+	digits, ok := strings.CutPrefix(revision, "v")
+	if !ok {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(digits, 10, 64)
+	return version, err == nil && version > 0
+}
+
+// describeRevision renders a revision for conflict messages
+func describeRevision(revision string) string {
+	if revision == "" {
+		return "no such secret"
+	}
+	return revision
+}
@@ -0,0 +1,726 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+)
+
+// DefaultTTL is how long a cached vault is used without asking the API
+const DefaultTTL = 5 * time.Minute
+
+// DefaultMaxStaleness is the oldest copy served when the API is unreachable
+const DefaultMaxStaleness = 7 * 24 * time.Hour
+
+var (
+	// ErrOffline is returned for writes while working offline
+	ErrOffline = errors.New("offline: this needs the API")
+
+	// ErrNoSnapshot is returned offline when there is no local copy yet
+	ErrNoSnapshot = errors.New("no offline copy of your vault yet; run 'egg get' once while online")
+
+	// ErrTooStale is returned offline when the local copy is older than the
+	// max staleness policy allows
+	ErrTooStale = errors.New("offline copy is too old")
+)
+
+// Options configures a cached Store
+type Options struct {
+	Path  string // Cache file, see Path
+	Owner string // The only owner whose reads are cached
+	Key   []byte // KeySize bytes, held in the session
+	TTL   time.Duration
+
+	// Offline serves every read from the local copy without trying the API
+	Offline bool
+
+	// MaxStaleness is the oldest copy served offline; 0 means no limit
+	MaxStaleness time.Duration
+
+	// OnOffline is called once, before the first read served from the
+	// local copy because of Offline or an unreachable API (cause is nil
+	// for Offline). syncedAt is when the API last confirmed the copy.
+	OnOffline func(syncedAt time.Time, cause error)
+}
+
+// Store wraps another api.Store and serves decrypted reads from the
+// encrypted cache file while it is younger than the TTL. After that, the
+// cache is revalidated: backends implementing api.SnapshotStore are asked
+// with an ETag whether the vault changed, which costs one cheap request
+// when it didn't.
+//
+// When the API is unreachable or failing (see api.IsUnavailable), reads of
+// the owner's vault, metadata included, fall back to the local copy as long
+// as it is within MaxStaleness. From then on the Store stays offline.
+//
+// The cache is otherwise disposable: any problem reading or writing it just
+// means asking the backend instead.
+type Store struct {
+	api.Store
+	opts Options
+
+	mu       sync.Mutex
+	snapshot *Snapshot // nil until loaded or fetched
+	loaded   bool      // The file has been read, successfully or not
+	offline  bool      // Reads are served from the snapshot only
+	notified bool      // OnOffline has been called
+}
+
+var (
+	_ api.ConditionalStore = (*Store)(nil)
+	_ api.HistoryStore     = (*Store)(nil)
+	_ api.TrashStore       = (*Store)(nil)
+	_ api.MetadataStore    = (*Store)(nil)
+)
+
+// New wraps inner with an encrypted cache
+func New(inner api.Store, opts Options) *Store {
+	return &Store{Store: inner, opts: opts, offline: opts.Offline}
+}
+
+// Unwrap returns the backend behind the cache, for reads that must be fresh
+func (s *Store) Unwrap() api.Store {
+	return s.Store
+}
+
+// Offline reports whether reads are being served from the local copy
+func (s *Store) Offline() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offline
+}
+
+// PutEgg stores a secret and updates the cached copy to match
+func (s *Store) PutEgg(ctx context.Context, owner string, req api.PutEggRequest) error {
+	if s.Offline() {
+		return fmt.Errorf("cannot store %q: %w", req.SecretID, ErrOffline)
+	}
+	if err := s.Store.PutEgg(ctx, owner, req); err != nil {
+		return err
+	}
+	s.updatePut(owner, req)
+	return nil
+}
+
+// PutEggIfMatch stores a secret conditionally if the backend supports it
+// (see api.ConditionalStore), and updates the cached copy to match
+func (s *Store) PutEggIfMatch(ctx context.Context, owner string, req api.PutEggRequest, ifMatch api.Precondition) error {
+	if s.Offline() {
+		return fmt.Errorf("cannot store %q: %w", req.SecretID, ErrOffline)
+	}
+	conditional, ok := s.Store.(api.ConditionalStore)
+	if !ok {
+		return fmt.Errorf("the storage backend cannot check versions: %w", errors.ErrUnsupported)
+	}
+	if err := conditional.PutEggIfMatch(ctx, owner, req, ifMatch); err != nil {
+		return err
+	}
+	s.updatePut(owner, req)
+	return nil
+}
+
+// EggHistory streams a secret's history from the backend if it keeps one
+// (see api.HistoryStore). History is never cached.
+func (s *Store) EggHistory(ctx context.Context, owner, secretID string, withValues bool) iter.Seq2[api.EggVersion, error] {
+	history, err := s.history(secretID)
+	if err != nil {
+		return func(yield func(api.EggVersion, error) bool) {
+			yield(api.EggVersion{}, err)
+		}
+	}
+	return history.EggHistory(ctx, owner, secretID, withValues)
+}
+
+// GetEggVersion returns one version of a secret from the backend
+func (s *Store) GetEggVersion(ctx context.Context, owner, secretID string, version int64) (*api.GetEggResponse, error) {
+	history, err := s.history(secretID)
+	if err != nil {
+		return nil, err
+	}
+	return history.GetEggVersion(ctx, owner, secretID, version)
+}
+
+// history returns the backend's history support, which needs the server
+func (s *Store) history(secretID string) (api.HistoryStore, error) {
+	if s.Offline() {
+		return nil, fmt.Errorf("cannot read the history of %q: %w", secretID, ErrOffline)
+	}
+	history, ok := s.Store.(api.HistoryStore)
+	if !ok {
+		return nil, fmt.Errorf("the storage backend doesn't keep history: %w", errors.ErrUnsupported)
+	}
+	return history, nil
+}
+
+// updatePut applies a successful put to the cached copy, metadata included.
+// It also bumps the cached version by one, as the API does on every write,
+// so a write queued offline right after this one is made against the new
+// revision rather than conflicting with this one when pushed. Without
+// versions the server's timestamp isn't known, so such a write still
+// conflicts.
+func (s *Store) updatePut(owner string, req api.PutEggRequest) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	s.update(owner, func(snapshot *Snapshot) {
+		for i, egg := range snapshot.Eggs {
+			if egg.SecretID == req.SecretID {
+				snapshot.Eggs[i].Plaintext = req.Plaintext
+				snapshot.Eggs[i].SecretMetadata = egg.SecretMetadata.Merged(req.Metadata)
+				snapshot.Eggs[i].UpdatedAt = now
+				if egg.Version > 0 {
+					snapshot.Eggs[i].Version++
+				}
+				return
+			}
+		}
+		versioned := slices.ContainsFunc(snapshot.Eggs, func(egg api.GetEggResponse) bool { return egg.Version > 0 })
+		egg := api.GetEggResponse{Owner: owner, SecretID: req.SecretID, Plaintext: req.Plaintext, CreatedAt: now, SecretMetadata: api.SecretMetadata{}.Merged(req.Metadata)}
+		if versioned {
+			egg.Version = 1
+		}
+		snapshot.Eggs = append(snapshot.Eggs, egg)
+	})
+}
+
+// ApplyQueued shows a write queued in the outbox in the local copy, so
+// offline reads see it. The secret keeps its revision, which is the one the
+// write was queued against; a new secret gets none, like one that doesn't
+// exist.
+func (s *Store) ApplyQueued(op Op) {
+	s.update(s.opts.Owner, func(snapshot *Snapshot) {
+		i := slices.IndexFunc(snapshot.Eggs, func(egg api.GetEggResponse) bool { return egg.SecretID == op.SecretID })
+		switch {
+		case op.Kind == OpDelete && i >= 0:
+			snapshot.Eggs = slices.Delete(snapshot.Eggs, i, i+1)
+		case op.Kind == OpPut && i >= 0:
+			snapshot.Eggs[i].Plaintext = op.Plaintext
+			snapshot.Eggs[i].SecretMetadata = snapshot.Eggs[i].SecretMetadata.Merged(op.Metadata)
+		case op.Kind == OpPut:
+			snapshot.Eggs = append(snapshot.Eggs, api.GetEggResponse{Owner: s.opts.Owner, SecretID: op.SecretID, Plaintext: op.Plaintext, SecretMetadata: api.SecretMetadata{}.Merged(op.Metadata)})
+		}
+	})
+}
+
+// BreakEgg deletes a secret and drops it from the cached copy
+func (s *Store) BreakEgg(ctx context.Context, owner, secretID string) error {
+	if s.Offline() {
+		return fmt.Errorf("cannot delete %q: %w", secretID, ErrOffline)
+	}
+	if err := s.Store.BreakEgg(ctx, owner, secretID); err != nil {
+		return err
+	}
+	s.updateBreak(owner, secretID)
+	return nil
+}
+
+// updateBreak removes a deleted secret from the cached copy
+func (s *Store) updateBreak(owner, secretID string) {
+	s.update(owner, func(snapshot *Snapshot) {
+		snapshot.Eggs = slices.DeleteFunc(snapshot.Eggs, func(egg api.GetEggResponse) bool {
+			return egg.SecretID == secretID
+		})
+	})
+}
+
+// BreakEggIfMatch deletes a secret conditionally if the backend supports
+// it (see api.ConditionalStore), and removes it from the cached copy
+func (s *Store) BreakEggIfMatch(ctx context.Context, owner, secretID string, ifMatch api.Precondition) error {
+	if s.Offline() {
+		return fmt.Errorf("cannot delete %q: %w", secretID, ErrOffline)
+	}
+	conditional, ok := s.Store.(api.ConditionalStore)
+	if !ok {
+		return fmt.Errorf("the storage backend cannot check versions: %w", errors.ErrUnsupported)
+	}
+	if err := conditional.BreakEggIfMatch(ctx, owner, secretID, ifMatch); err != nil {
+		return err
+	}
+	s.updateBreak(owner, secretID)
+	return nil
+}
+
+// AllTrash streams the backend's trash, if it has one (see api.TrashStore).
+// The trash is never cached.
+func (s *Store) AllTrash(ctx context.Context, owner string) iter.Seq2[api.TrashedEgg, error] {
+	trash, err := s.trash("list the trash")
+	if err != nil {
+		return func(yield func(api.TrashedEgg, error) bool) {
+			yield(api.TrashedEgg{}, err)
+		}
+	}
+	return trash.AllTrash(ctx, owner)
+}
+
+// TrashRetention asks the backend how long it keeps deleted secrets
+func (s *Store) TrashRetention(ctx context.Context, owner string) (time.Duration, error) {
+	trash, err := s.trash("check the trash")
+	if err != nil {
+		return 0, err
+	}
+	return trash.TrashRetention(ctx, owner)
+}
+
+// RestoreEgg moves a secret out of the trash. The cached copy is marked
+// for revalidation, since the restored value isn't known here.
+func (s *Store) RestoreEgg(ctx context.Context, owner, secretID string) error {
+	trash, err := s.trash(fmt.Sprintf("restore %q", secretID))
+	if err != nil {
+		return err
+	}
+	if err := trash.RestoreEgg(ctx, owner, secretID); err != nil {
+		return err
+	}
+	s.update(owner, func(*Snapshot) {})
+	return nil
+}
+
+// PurgeEgg permanently deletes a secret and drops it from the cached copy
+func (s *Store) PurgeEgg(ctx context.Context, owner, secretID string) error {
+	trash, err := s.trash(fmt.Sprintf("purge %q", secretID))
+	if err != nil {
+		return err
+	}
+	if err := trash.PurgeEgg(ctx, owner, secretID); err != nil {
+		return err
+	}
+	s.update(owner, func(snapshot *Snapshot) {
+		snapshot.Eggs = slices.DeleteFunc(snapshot.Eggs, func(egg api.GetEggResponse) bool {
+			return egg.SecretID == secretID
+		})
+	})
+	return nil
+}
+
+// UpdateEggMetadata changes a secret's metadata if the backend supports it
+// (see api.MetadataStore), and updates the cached copy to match
+func (s *Store) UpdateEggMetadata(ctx context.Context, owner, secretID string, patch api.MetadataPatch) (*api.EggMetadata, error) {
+	if s.Offline() {
+		return nil, fmt.Errorf("cannot update the metadata of %q: %w", secretID, ErrOffline)
+	}
+	metadataStore, ok := s.Store.(api.MetadataStore)
+	if !ok {
+		return nil, fmt.Errorf("the storage backend cannot update metadata: %w", errors.ErrUnsupported)
+	}
+	meta, err := metadataStore.UpdateEggMetadata(ctx, owner, secretID, patch)
+	if err != nil {
+		return nil, err
+	}
+	s.update(owner, func(snapshot *Snapshot) {
+		for i, egg := range snapshot.Eggs {
+			if egg.SecretID == secretID {
+				snapshot.Eggs[i].SecretMetadata = meta.SecretMetadata
+			}
+		}
+	})
+	return meta, nil
+}
+
+// trash returns the backend's trash, which needs the server
+func (s *Store) trash(action string) (api.TrashStore, error) {
+	if s.Offline() {
+		return nil, fmt.Errorf("cannot %s: %w", action, ErrOffline)
+	}
+	trash, ok := s.Store.(api.TrashStore)
+	if !ok {
+		return nil, fmt.Errorf("the storage backend has no trash: %w", errors.ErrUnsupported)
+	}
+	return trash, nil
+}
+
+// GetEggByKey serves a secret from the cache while it is fresh, and
+// otherwise asks the backend for just that secret rather than downloading
+// the whole vault. The local copy is the fallback if the backend is
+// unavailable.
+func (s *Store) GetEggByKey(ctx context.Context, owner, secretID string) (*api.GetEggResponse, error) {
+	if owner != s.opts.Owner {
+		return s.Store.GetEggByKey(ctx, owner, secretID)
+	}
+
+	snapshot, ok, err := s.cached()
+	if !ok {
+		egg, fetchErr := s.Store.GetEggByKey(ctx, owner, secretID)
+		if !api.IsUnavailable(fetchErr) {
+			return egg, fetchErr
+		}
+		snapshot, err = s.fallback(fetchErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	eggs, missing := pick(snapshot, []string{secretID})
+	switch {
+	case len(missing) == 0:
+		return &eggs[0], nil
+	case s.Offline():
+		return nil, fmt.Errorf("secret %q is not in the offline copy: %w", secretID, api.ErrNotFound)
+	}
+	return s.Store.GetEggByKey(ctx, owner, secretID)
+}
+
+// GetEggsByKeys serves secrets from the cache while it is fresh and has all
+// of them, and otherwise asks the backend for just those secrets, like
+// GetEggByKey
+func (s *Store) GetEggsByKeys(ctx context.Context, owner string, secretIDs []string) ([]api.GetEggResponse, error) {
+	if owner != s.opts.Owner {
+		return s.Store.GetEggsByKeys(ctx, owner, secretIDs)
+	}
+
+	snapshot, ok, err := s.cached()
+	if !ok {
+		eggs, fetchErr := s.Store.GetEggsByKeys(ctx, owner, secretIDs)
+		if !api.IsUnavailable(fetchErr) {
+			return eggs, fetchErr
+		}
+		snapshot, err = s.fallback(fetchErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	eggs, missing := pick(snapshot, secretIDs)
+	switch {
+	case len(missing) == 0:
+		return eggs, nil
+	case s.Offline():
+		errs := make([]error, len(missing))
+		for i, id := range missing {
+			errs[i] = fmt.Errorf("secret %q is not in the offline copy: %w", id, api.ErrNotFound)
+		}
+		return nil, errors.Join(errs...)
+	}
+	return s.Store.GetEggsByKeys(ctx, owner, secretIDs)
+}
+
+// AllEggs streams the vault from the cache
+func (s *Store) AllEggs(ctx context.Context, owner string) iter.Seq2[api.GetEggResponse, error] {
+	if owner != s.opts.Owner {
+		return s.Store.AllEggs(ctx, owner)
+	}
+	return func(yield func(api.GetEggResponse, error) bool) {
+		snapshot, err := s.current(ctx)
+		if err != nil {
+			yield(api.GetEggResponse{}, err)
+			return
+		}
+		for _, egg := range snapshot.Eggs {
+			if !yield(egg, nil) {
+				return
+			}
+		}
+	}
+}
+
+// AllEggMetadata streams metadata from the backend, or from the local copy
+// when offline. The copy's metadata is as of the last sync, plus the writes
+// made or queued since.
+func (s *Store) AllEggMetadata(ctx context.Context, owner string) iter.Seq2[api.EggMetadata, error] {
+	if owner != s.opts.Owner {
+		return s.Store.AllEggMetadata(ctx, owner)
+	}
+	return func(yield func(api.EggMetadata, error) bool) {
+		var cause error
+		if !s.Offline() {
+			yielded := false
+			for egg, err := range s.Store.AllEggMetadata(ctx, owner) {
+				// Fall back only before anything was yielded, so a
+				// listing never mixes live and cached entries
+				if err != nil && !yielded && api.IsUnavailable(err) {
+					cause = err
+					break
+				}
+				if !yield(egg, err) || err != nil {
+					return
+				}
+				yielded = true
+			}
+			if cause == nil {
+				return
+			}
+		}
+
+		snapshot, err := s.fallback(cause)
+		if err != nil {
+			yield(api.EggMetadata{}, err)
+			return
+		}
+		for _, egg := range snapshot.Eggs {
+			if !yield(metadataOf(egg), nil) {
+				return
+			}
+		}
+	}
+}
+
+// GetEggMetadata returns one secret's metadata, from the local copy when
+// offline
+func (s *Store) GetEggMetadata(ctx context.Context, owner, secretID string) (*api.EggMetadata, error) {
+	if owner != s.opts.Owner {
+		return s.Store.GetEggMetadata(ctx, owner, secretID)
+	}
+
+	var cause error
+	if !s.Offline() {
+		meta, err := s.Store.GetEggMetadata(ctx, owner, secretID)
+		if !api.IsUnavailable(err) {
+			return meta, err
+		}
+		cause = err
+	}
+
+	snapshot, err := s.fallback(cause)
+	if err != nil {
+		return nil, err
+	}
+	for _, egg := range snapshot.Eggs {
+		if egg.SecretID == secretID {
+			meta := metadataOf(egg)
+			return &meta, nil
+		}
+	}
+	return nil, fmt.Errorf("secret %q is not in the offline copy: %w", secretID, api.ErrNotFound)
+}
+
+// current returns a snapshot that is within the TTL, revalidating or
+// refetching it from the backend if needed. When offline, or when the
+// backend is unavailable, it returns the local copy instead.
+func (s *Store) current(ctx context.Context) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if snapshot, ok, err := s.usable(); ok {
+		return snapshot, err
+	}
+
+	snapshot, err := s.revalidate(ctx)
+	if api.IsUnavailable(err) {
+		return s.offlineSnapshot(err)
+	}
+	return snapshot, err
+}
+
+// cached returns the snapshot if reads are served from it without asking
+// the backend, which is while it is within the TTL or when offline. ok is
+// false if the backend must be asked.
+func (s *Store) cached() (snapshot *Snapshot, ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usable()
+}
+
+// usable implements cached; the caller holds s.mu
+func (s *Store) usable() (*Snapshot, bool, error) {
+	s.load()
+	if s.offline {
+		snapshot, err := s.offlineSnapshot(nil)
+		return snapshot, true, err
+	}
+	if s.snapshot != nil && !s.snapshot.Dirty && time.Since(s.snapshot.FetchedAt) < s.opts.TTL {
+		return s.snapshot, true, nil
+	}
+	return nil, false, nil
+}
+
+// Refresh brings the local copy up to date now, whatever its age, and
+// returns it. It never falls back to the local copy.
+func (s *Store) Refresh(ctx context.Context) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.load()
+	if s.offline {
+		return nil, fmt.Errorf("cannot refresh the local copy: %w", ErrOffline)
+	}
+	return s.revalidate(ctx)
+}
+
+// LocalRevision returns the revision of a secret in the local copy (see
+// api.GetEggResponse.Revision) without contacting the API, or "" if the
+// copy doesn't have it
+func (s *Store) LocalRevision(secretID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.load()
+	if s.snapshot == nil {
+		return "", ErrNoSnapshot
+	}
+	for _, egg := range s.snapshot.Eggs {
+		if egg.SecretID == secretID {
+			return egg.Revision(), nil
+		}
+	}
+	return "", nil
+}
+
+// revalidate asks the backend for the vault, conditionally if there is a
+// local copy, and persists the result; the caller holds s.mu
+func (s *Store) revalidate(ctx context.Context) (*Snapshot, error) {
+	// 1. Revalidate with the ETag if the backend supports it
+	etag := ""
+	if s.snapshot != nil {
+		etag = s.snapshot.ETag
+	}
+	fresh, err := s.fetch(ctx, etag)
+	switch {
+	case errors.Is(err, api.ErrNotModified) && s.snapshot != nil:
+		s.snapshot.FetchedAt = time.Now()
+		s.snapshot.Dirty = false
+		s.persist()
+		return s.snapshot, nil
+	case err != nil:
+		return nil, err
+	}
+
+	// 2. Otherwise replace the cache with what the backend returned
+	fresh.FetchedAt = time.Now()
+	s.snapshot = fresh
+	s.persist()
+	return s.snapshot, nil
+}
+
+// fallback switches to the local copy after the backend failed with cause
+func (s *Store) fallback(cause error) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.load()
+	return s.offlineSnapshot(cause)
+}
+
+// offlineSnapshot returns the local copy if the staleness policy allows it,
+// switching the Store offline; the caller holds s.mu. cause is the backend
+// error that forced this, or nil when working offline on purpose.
+func (s *Store) offlineSnapshot(cause error) (*Snapshot, error) {
+	if s.snapshot == nil {
+		if cause != nil {
+			return nil, fmt.Errorf("%w (and %w)", cause, ErrNoSnapshot)
+		}
+		return nil, ErrNoSnapshot
+	}
+
+	age := time.Since(s.snapshot.FetchedAt)
+	if s.opts.MaxStaleness > 0 && age > s.opts.MaxStaleness {
+		err := fmt.Errorf("%w: last synced %s ago, the limit is %s (cache.max_staleness)", ErrTooStale, formatAge(age), formatAge(s.opts.MaxStaleness))
+		if cause != nil {
+			return nil, fmt.Errorf("%w (and the %w)", cause, err)
+		}
+		return nil, err
+	}
+
+	s.offline = true
+	if !s.notified && s.opts.OnOffline != nil {
+		s.notified = true
+		s.opts.OnOffline(s.snapshot.FetchedAt, cause)
+	}
+	return s.snapshot, nil
+}
+
+// fetch downloads the vault, conditionally when the backend supports it
+func (s *Store) fetch(ctx context.Context, etag string) (*Snapshot, error) {
+	if snapshots, ok := s.Store.(api.SnapshotStore); ok {
+		vault, err := snapshots.FetchSnapshot(ctx, s.opts.Owner, etag)
+		if err != nil {
+			return nil, err
+		}
+		return &Snapshot{ETag: vault.ETag, Eggs: vault.Eggs}, nil
+	}
+
+	snapshot := &Snapshot{Eggs: []api.GetEggResponse{}}
+	for egg, err := range s.Store.AllEggs(ctx, s.opts.Owner) {
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Eggs = append(snapshot.Eggs, egg)
+	}
+	return snapshot, nil
+}
+
+// update applies a successful write to the cached copy and marks it for
+// revalidation, since the vault's ETag has changed. The caller must not
+// hold s.mu.
+func (s *Store) update(owner string, apply func(*Snapshot)) {
+	if owner != s.opts.Owner {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.load()
+	if s.snapshot == nil {
+		return
+	}
+	apply(s.snapshot)
+	s.snapshot.Dirty = true
+	s.persist()
+}
+
+// load reads the cache file once; the caller holds s.mu
+func (s *Store) load() {
+	if s.loaded {
+		return
+	}
+	s.loaded = true
+	if snapshot, err := load(s.opts.Path, s.opts.Owner, s.opts.Key); err == nil {
+		s.snapshot = snapshot
+	}
+}
+
+// persist writes the snapshot; the caller holds s.mu. If that fails, the
+// file is removed so an outdated copy can never be served.
+func (s *Store) persist() {
+	if err := save(s.opts.Path, s.opts.Owner, s.opts.Key, s.snapshot); err != nil {
+		remove(s.opts.Path)
+	}
+}
+
+// pick returns the requested secrets in order, or the IDs the snapshot
+// doesn't have
+func pick(snapshot *Snapshot, secretIDs []string) ([]api.GetEggResponse, []string) {
+	byID := make(map[string]api.GetEggResponse, len(snapshot.Eggs))
+	for _, egg := range snapshot.Eggs {
+		byID[egg.SecretID] = egg
+	}
+
+	eggs := make([]api.GetEggResponse, 0, len(secretIDs))
+	var missing []string
+	for _, id := range secretIDs {
+		egg, ok := byID[id]
+		if !ok {
+			missing = append(missing, id)
+			continue
+		}
+		eggs = append(eggs, egg)
+	}
+	return eggs, missing
+}
+
+// metadataOf derives metadata from a cached secret
+func metadataOf(egg api.GetEggResponse) api.EggMetadata {
+	return api.EggMetadata{
+		SecretID:       egg.SecretID,
+		CreatedAt:      egg.CreatedAt,
+		UpdatedAt:      egg.UpdatedAt,
+		Version:        egg.Version,
+		Size:           len(egg.Plaintext),
+		SecretMetadata: egg.SecretMetadata,
+	}
+}
+
+// formatAge renders a duration in days once it is that long, e.g. "8d3h"
+func formatAge(d time.Duration) string {
+	d = d.Round(time.Minute)
+	day := 24 * time.Hour
+	if d < day {
+		return d.String()
+	}
+	if rest := (d % day).Round(time.Hour); rest > 0 {
+		return fmt.Sprintf("%dd%dh", d/day, rest/time.Hour)
+	}
+	return fmt.Sprintf("%dd", d/day)
+}
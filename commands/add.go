@@ -1,71 +1,244 @@
 package commands
 
 import (
+	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
 
+	"github.com/joho/godotenv"
 	"github.com/owenHochwald/egg-carton/cli/api"
-	"github.com/owenHochwald/egg-carton/cli/auth"
-	"github.com/owenHochwald/egg-carton/cli/config"
+	"github.com/owenHochwald/egg-carton/cli/cache"
 	"github.com/spf13/cobra"
 )
 
 // AddCmd represents the lay command (alias: add)
 var AddCmd = &cobra.Command{
-	Use:     "lay [key] [value]",
+	Use:     "lay <key> <value> | KEY=VALUE... | --from-file FILE",
 	Aliases: []string{"add"},
-	Short:   "Store a secret (lay an egg)",
-	Long:    `Encrypt and store a secret in your EggCarton vault.`,
-	Args:    cobra.ExactArgs(2),
-	RunE:    runAdd,
+	Short:   "Store secrets (lay eggs)",
+	Long: `Encrypt and store secrets in your EggCarton vault.
+
+Keys become environment variable names in 'egg hatch', so they must start
+with a letter or underscore, contain only letters, digits and '_', and be at
+most 128 characters. PATH, HOME and other variables a process relies on are
+reserved, as is the EGG_ prefix.
+
+Several secrets can be stored at once as KEY=VALUE pairs, or read from a
+.env file ('-' for stdin). They are sent a few at a time; a table shows the
+result of each, and the exit code is non-zero if any failed.
+
+--description, --owner-team and --tag record what a secret is for and who
+looks after it, and --expires when it stops working ('egg expiring' lists
+secrets close to that date). They apply to every secret stored and leave
+metadata that isn't given unchanged. Use 'egg meta set' to change metadata
+alone.
+
+--if-match VERSION stores a single secret only if it is still at the version
+shown by 'egg get' or 'egg list' (0: only if it doesn't exist yet), so a
+concurrent change is reported as a conflict instead of being overwritten.
+
+Example:
+  egg lay API_KEY abc123
+  egg lay API_KEY=abc123 DB_URL=postgres://localhost/app
+  egg lay --from-file .env.production
+  egg lay --if-match 3 API_KEY def456
+  egg lay -m "rotate after incident" API_KEY ghi789
+  egg lay --description "Stripe live key" --owner-team payments --tag env=prod STRIPE_KEY sk_live_...
+  egg lay --expires 90d VENDOR_API_KEY abc123`,
+	Args: cobra.ArbitraryArgs,
+	RunE: runAdd,
 }
 
-func runAdd(cmd *cobra.Command, args []string) error {
-	key := args[0]
-	value := args[1]
+var addFlags struct {
+	fromFile    string
+	ifMatch     int64
+	message     string
+	description string
+	ownerTeam   string
+	tags        []string
+	expires     string
+}
 
-	fmt.Printf("🐔 Laying egg: %s\n", key)
+func init() {
+	flags := AddCmd.Flags()
+	flags.StringVarP(&addFlags.fromFile, "from-file", "f", "", "read KEY=VALUE lines from a .env file, or - for stdin")
+	flags.Int64Var(&addFlags.ifMatch, "if-match", 0, "only store if the secret is still at this version (0: doesn't exist yet)")
+	flags.StringVarP(&addFlags.message, "message", "m", "", "change note recorded in the secret's history")
+	flags.StringVar(&addFlags.description, "description", "", "what the secret is for")
+	flags.StringVar(&addFlags.ownerTeam, "owner-team", "", "team responsible for the secret")
+	flags.StringArrayVar(&addFlags.tags, "tag", nil, "tag the secret with key=value (repeatable)")
+	flags.StringVar(&addFlags.expires, "expires", "", "when the secret expires: a duration like 90d or a date like 2027-01-01")
+}
 
-	config, err := config.LoadConfig()
+func runAdd(cmd *cobra.Command, args []string) error {
+	// 1. Collect and validate every secret before touching the network
+	items, err := putItems(cmd, args)
+	if err != nil {
+		return err
+	}
+	metadata, err := metadataFromFlags(addFlags.description, addFlags.ownerTeam, addFlags.tags, addFlags.expires)
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return err
+	}
+	for i := range items {
+		if err := api.ValidateSecretKey(items[i].SecretID); err != nil {
+			return err
+		}
+		items[i].Note = addFlags.message
+		items[i].Metadata = metadata
+	}
+	ifMatch := cmd.Flags().Changed("if-match")
+	if ifMatch && len(items) != 1 {
+		return errors.New("--if-match works with a single secret")
+	}
+
+	if len(items) == 1 {
+		fmt.Printf("🐔 Laying egg: %s\n", items[0].SecretID)
+	} else {
+		fmt.Printf("🐔 Laying %d eggs...\n", len(items))
 	}
 
-	tokens, err := config.LoadTokens()
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	// 2. Load config, tokens and storage backend
+	sess, err := newSession(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to load tokens: %w", err)
+		return err
+	}
+
+	// 3. A conditional write needs the server, so it is never queued
+	if ifMatch {
+		item := items[0]
+		if err := putIfMatch(ctx, sess, item, api.Precondition{Version: addFlags.ifMatch}); err != nil {
+			// Only the version was given, so look up when it was written
+			var conflict *api.ConflictError
+			if errors.As(err, &conflict) {
+				conflict.Expected.UpdatedAt = versionWrittenAt(ctx, sess, item.SecretID, addFlags.ifMatch)
+			}
+			return fmt.Errorf("failed to lay egg: %w", err)
+		}
+		fmt.Printf("✅ Successfully laid egg: %s\n", item.SecretID)
+		return nil
+	}
+
+	// 4. Store them a few at a time, queueing any that fail while offline.
+	// A queued write keeps the Idempotency-Key it was first sent with, in
+	// case it reached the server before failing.
+	for i := range items {
+		items[i].IdempotencyKey = rand.Text()
+	}
+	errs := api.PutEggs(ctx, sess.store, sess.owner, items)
+	results := make([]batchResult, len(items))
+	for i, item := range items {
+		op := cache.Op{ID: item.IdempotencyKey, Kind: cache.OpPut, SecretID: item.SecretID, Plaintext: item.Plaintext, Note: item.Note, Metadata: item.Metadata}
+		queued, err := queueOffline(sess, op, errs[i])
+		results[i] = batchResult{key: item.SecretID, err: err, queued: queued}
+	}
+
+	// 5. Print the outcome
+	if len(results) > 1 {
+		return printBatch("lay", "laid", results)
 	}
-	// 3. Check if token is valid (refresh if needed)
-	if tokens == nil {
-		return fmt.Errorf("you are not logged in. Please run 'egg login' first")
+	switch result := results[0]; {
+	case result.err != nil:
+		return fmt.Errorf("failed to lay egg: %w", result.err)
+	case result.queued:
+		printQueued(cache.Op{Kind: cache.OpPut, SecretID: result.key})
+	default:
+		fmt.Printf("✅ Successfully laid egg: %s\n", result.key)
 	}
-	if !tokens.IsTokenValid() {
-		fmt.Println("⏰ Token expired, refreshing...")
-		newTokens, err := auth.RefreshAccessToken(config.GetTokenURL(), config.CognitoConfig.ClientID, tokens.RefreshToken)
+	return nil
+}
+
+// putItems turns the arguments and --from-file into the secrets to store.
+// "lay KEY VALUE" keeps working alongside "lay KEY=VALUE...".
+func putItems(cmd *cobra.Command, args []string) ([]api.PutEggRequest, error) {
+	var items []api.PutEggRequest
+
+	switch {
+	case len(args) == 2 && !strings.Contains(args[0], "="):
+		items = append(items, api.PutEggRequest{SecretID: args[0], Plaintext: args[1]})
+	default:
+		for _, arg := range args {
+			key, value, ok := strings.Cut(arg, "=")
+			if !ok || key == "" {
+				return nil, fmt.Errorf("invalid argument %q: use KEY=VALUE, or 'egg lay KEY VALUE' for a single secret", arg)
+			}
+			items = append(items, api.PutEggRequest{SecretID: key, Plaintext: value})
+		}
+	}
+
+	if addFlags.fromFile != "" {
+		fromFile, err := readEnvFile(cmd.InOrStdin(), addFlags.fromFile)
 		if err != nil {
-			return fmt.Errorf("failed to refresh token: %w", err)
+			return nil, err
 		}
-		if err := config.SaveTokens(newTokens); err != nil {
-			return fmt.Errorf("failed to save refreshed tokens: %w", err)
+		items = append(items, fromFile...)
+	}
+
+	if len(items) == 0 {
+		return nil, errors.New("nothing to lay: give KEY VALUE, KEY=VALUE pairs or --from-file")
+	}
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		if seen[item.SecretID] {
+			return nil, fmt.Errorf("%s is given more than once", item.SecretID)
 		}
-		tokens = newTokens
+		seen[item.SecretID] = true
 	}
+	return items, nil
+}
 
-	// 4. Extract owner from token
-	owner, err := config.GetOwner()
-	if err != nil {
-		return fmt.Errorf("failed to extract owner from token: %w", err)
+// readEnvFile parses a .env file, or stdin for "-", in key order
+func readEnvFile(stdin io.Reader, path string) ([]api.PutEggRequest, error) {
+	r := stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		defer f.Close()
+		r = f
 	}
 
-	// 5. Create API client
-	client := api.NewClient(config.GetAPIBaseURL(), tokens.AccessToken)
+	env, err := godotenv.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
 
-	// 6. Call PutEgg(owner, key, value)
-	if err := client.PutEgg(owner, key, value); err != nil {
-		return fmt.Errorf("failed to lay egg: %w", err)
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
 
-	// 7. Print success message
-	fmt.Printf("✅ Successfully laid egg: %s\n", key)
+	items := make([]api.PutEggRequest, len(keys))
+	for i, key := range keys {
+		items[i] = api.PutEggRequest{SecretID: key, Plaintext: env[key]}
+	}
+	return items, nil
+}
 
-	return nil
+// versionWrittenAt returns when a version of a secret was written, or "" if
+// the backend keeps no history or the version is gone
+func versionWrittenAt(ctx context.Context, sess *session, key string, version int64) string {
+	store, err := historyStore(sess)
+	if err != nil {
+		return ""
+	}
+	for v, err := range store.EggHistory(ctx, sess.owner, key, false) {
+		if err != nil || v.Version < version {
+			break
+		}
+		if v.Version == version {
+			return v.WrittenAt
+		}
+	}
+	return ""
 }
@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// batchResult is the outcome of one item of a multi-secret command
+type batchResult struct {
+	key    string
+	err    error
+	queued bool // Queued in the outbox while offline
+}
+
+// batchError reports the failed items of a batch. Its message is only a
+// summary, since the result table already shows each failure; the item
+// errors still decide the exit code.
+type batchError struct {
+	verb   string
+	failed []error
+	total  int
+}
+
+func (e *batchError) Error() string {
+	return fmt.Sprintf("failed to %s %d of %d egg(s)", e.verb, len(e.failed), e.total)
+}
+
+func (e *batchError) Unwrap() []error {
+	return e.failed
+}
+
+// printBatch prints a result table, done describing a success (e.g.
+// "laid"), and returns a *batchError if any item failed
+func printBatch(verb, done string, results []batchResult) error {
+	var failed []error
+	queued := 0
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tRESULT")
+	for _, result := range results {
+		switch {
+		case result.err != nil:
+			failed = append(failed, result.err)
+			fmt.Fprintf(w, "%s\t❌ %v\n", result.key, result.err)
+		case result.queued:
+			queued++
+			fmt.Fprintf(w, "%s\t📮 queued offline\n", result.key)
+		default:
+			fmt.Fprintf(w, "%s\t✅ %s\n", result.key, done)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if queued > 0 {
+		fmt.Printf("📮 %d change(s) queued. Run 'egg sync --push' once you're back online.\n", queued)
+	}
+	if len(failed) > 0 {
+		return &batchError{verb: verb, failed: failed, total: len(results)}
+	}
+	return nil
+}
@@ -4,66 +4,141 @@ import (
 	"fmt"
 
 	"github.com/owenHochwald/egg-carton/cli/api"
-	"github.com/owenHochwald/egg-carton/cli/auth"
-	"github.com/owenHochwald/egg-carton/cli/config"
+	"github.com/owenHochwald/egg-carton/cli/cache"
 	"github.com/spf13/cobra"
 )
 
 // BreakCmd represents the break command
 var BreakCmd = &cobra.Command{
-	Use:   "break [key]",
-	Short: "Delete a secret",
-	Long:  `Permanently delete a secret from your EggCarton vault.`,
-	Args:  cobra.ExactArgs(1),
-	RunE:  runBreak,
+	Use:   "break <key>...",
+	Short: "Delete secrets",
+	Long: `Move secrets from your EggCarton vault to the trash. They can be brought
+back with 'egg restore' until the API's retention window runs out; see
+'egg trash list'.
+
+--purge deletes them permanently instead, from the vault or the trash.
+Purging, deleting more than one secret, and deleting when the API doesn't
+report keeping a trash ask for confirmation first; pass --yes to skip it
+(required when there is no terminal to ask on).
+
+Several keys are deleted a few at a time; a table shows the result of each,
+and the exit code is non-zero if any failed.
+
+Example:
+  egg break OLD_TOKEN
+  egg break --yes API_KEY DB_URL
+  egg break --purge LEAKED_KEY`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runBreak,
 }
 
-func runBreak(cmd *cobra.Command, args []string) error {
-	key := args[0]
+var breakFlags struct {
+	purge bool
+	yes   bool
+}
 
-	fmt.Printf("💥 Breaking egg: %s\n", key)
+func init() {
+	flags := BreakCmd.Flags()
+	flags.BoolVar(&breakFlags.purge, "purge", false, "delete permanently instead of moving to the trash")
+	flags.BoolVarP(&breakFlags.yes, "yes", "y", false, "don't ask for confirmation")
+}
 
-	// 1. Load config
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+func runBreak(cmd *cobra.Command, args []string) error {
+	keys := args
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			return fmt.Errorf("%s is given more than once", key)
+		}
+		seen[key] = true
 	}
 
-	// 2. Load tokens (check if logged in)
-	tokens, err := cfg.LoadTokens()
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	// 1. Load config, tokens and storage backend
+	sess, err := newSession(ctx)
 	if err != nil {
-		return fmt.Errorf("you are not logged in. Please run 'egg login' first: %w", err)
+		return err
 	}
 
-	// 3. Check if token is valid (refresh if needed)
-	if !tokens.IsTokenValid() {
-		fmt.Println("⏰ Token expired, refreshing...")
-		newTokens, err := auth.RefreshAccessToken(cfg.GetTokenURL(), cfg.CognitoConfig.ClientID, tokens.RefreshToken)
-		if err != nil {
-			return fmt.Errorf("failed to refresh token: %w", err)
-		}
-		if err := cfg.SaveTokens(newTokens); err != nil {
-			return fmt.Errorf("failed to save refreshed tokens: %w", err)
+	// 2. Ask the server whether deletes go to its trash. If it doesn't say
+	// so, every delete may be permanent, so ask for confirmation as for a
+	// purge. Offline, deletes are queued and the server decides later.
+	trash, hasTrash := trashStore(sess)
+	soft, reachable := false, true
+	if hasTrash && !breakFlags.purge {
+		soft, reachable = keepsTrash(ctx, sess, trash)
+	}
+	permanent := breakFlags.purge || (!soft && reachable)
+	if !breakFlags.yes && (!soft || len(keys) > 1) {
+		if err := confirm(cmd, breakQuestion(keys, permanent, soft)); err != nil {
+			return err
 		}
-		tokens = newTokens
 	}
 
-	// 4. Extract owner from token
-	owner, err := cfg.GetOwner()
-	if err != nil {
-		return fmt.Errorf("failed to extract owner from token: %w", err)
+	if len(keys) == 1 {
+		fmt.Printf("💥 Breaking egg: %s\n", keys[0])
+	} else {
+		fmt.Printf("💥 Breaking %d eggs...\n", len(keys))
 	}
 
-	// 5. Create API client
-	client := api.NewClient(cfg.GetAPIBaseURL(), tokens.AccessToken)
-
-	// 6. Call BreakEgg(owner, secretID)
-	if err := client.BreakEgg(owner, key); err != nil {
-		return fmt.Errorf("failed to break egg: %w", err)
+	// 3. Delete them a few at a time, queueing deletes that fail while
+	// offline. Purges need the server.
+	var errs []error
+	if breakFlags.purge && hasTrash {
+		errs = api.PurgeEggs(ctx, trash, sess.owner, keys)
+	} else {
+		errs = api.BreakEggs(ctx, sess.store, sess.owner, keys)
+	}
+	results := make([]batchResult, len(keys))
+	for i, key := range keys {
+		if permanent {
+			results[i] = batchResult{key: key, err: errs[i]}
+			continue
+		}
+		queued, err := queueOffline(sess, cache.Op{Kind: cache.OpDelete, SecretID: key}, errs[i])
+		results[i] = batchResult{key: key, err: err, queued: queued}
 	}
 
-	// 7. Print confirmation message
-	fmt.Printf("✅ Successfully deleted secret: %s\n", key)
-
+	// 4. Print the outcome
+	done := "deleted"
+	switch {
+	case soft:
+		done = "moved to trash"
+	case permanent:
+		done = "deleted permanently"
+	}
+	if len(results) > 1 {
+		return printBatch("break", done, results)
+	}
+	switch result := results[0]; {
+	case result.err != nil:
+		return fmt.Errorf("failed to break egg: %w", result.err)
+	case result.queued:
+		printQueued(cache.Op{Kind: cache.OpDelete, SecretID: result.key})
+	case soft:
+		fmt.Printf("🗑️  Moved %s to the trash. Run 'egg restore %s' to bring it back.\n", result.key, result.key)
+	case permanent:
+		fmt.Printf("✅ Permanently deleted secret: %s\n", result.key)
+	default:
+		fmt.Printf("✅ Deleted secret: %s\n", result.key)
+	}
 	return nil
 }
+
+// breakQuestion is the confirmation prompt for deleting keys. Deletes that
+// are neither known to be soft nor permanent depend on the server.
+func breakQuestion(keys []string, permanent, soft bool) string {
+	what := keys[0]
+	if len(keys) > 1 {
+		what = fmt.Sprintf("%d secrets", len(keys))
+	}
+	switch {
+	case permanent:
+		return fmt.Sprintf("⚠️  Permanently delete %s? This cannot be undone.", what)
+	case soft:
+		return fmt.Sprintf("Move %s to the trash?", what)
+	}
+	return fmt.Sprintf("⚠️  Delete %s? The API can't be reached to check that it keeps deleted secrets in the trash.", what)
+}
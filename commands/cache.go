@@ -0,0 +1,144 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+	"github.com/owenHochwald/egg-carton/cli/cache"
+	"github.com/owenHochwald/egg-carton/cli/config"
+	"github.com/spf13/cobra"
+)
+
+// CacheCmd groups the commands that manage the local vault cache
+var CacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the encrypted local copy of your vault",
+	Long: `get and hatch keep an encrypted copy of your vault on disk, so repeated
+runs don't wait for the API. The copy is used for cache.ttl (5m by default)
+and then revalidated, which costs one request when nothing changed.
+
+The encryption key is stored with your login, so logging in again makes
+any old copy unreadable. Use --no-cache to bypass the cache for one command.
+
+When the API can't be reached, get, list and hatch fall back to the copy
+with a warning saying how old it is, as long as it is younger than
+cache.max_staleness (7d by default). --offline does this without trying
+the API at all.`,
+}
+
+// cacheClearCmd represents the cache clear command
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Delete the cached copy of your vault",
+	Args:  cobra.NoArgs,
+	RunE:  runCacheClear,
+}
+
+var cacheClearAll bool
+
+func init() {
+	cacheClearCmd.Flags().BoolVar(&cacheClearAll, "all", false, "clear the cache of every profile")
+	CacheCmd.AddCommand(cacheClearCmd)
+}
+
+func runCacheClear(cmd *cobra.Command, args []string) error {
+	if cacheClearAll {
+		if err := cache.ClearAll(); err != nil {
+			return err
+		}
+		fmt.Println("🧹 Cleared the cache of every profile")
+		return nil
+	}
+
+	cfg, err := config.LoadProfileUnchecked(globalFlags.profile)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := cache.Clear(cfg.Profile); err != nil {
+		return err
+	}
+	fmt.Printf("🧹 Cleared the cache of profile %q\n", cfg.Profile)
+	return nil
+}
+
+// cacheTTL returns the profile's cache TTL; zero disables the cache
+func cacheTTL(cfg *config.Config) (time.Duration, error) {
+	if cfg.Cache.TTL == "" {
+		return cache.DefaultTTL, nil
+	}
+	ttl, err := parseDuration(cfg.Cache.TTL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cache.ttl in profile %q: %w", cfg.Profile, err)
+	}
+	return ttl, nil
+}
+
+// maxStaleness returns the oldest copy the profile serves offline; zero
+// means no limit
+func maxStaleness(cfg *config.Config) (time.Duration, error) {
+	if cfg.Cache.MaxStaleness == "" {
+		return cache.DefaultMaxStaleness, nil
+	}
+	d, err := parseDuration(cfg.Cache.MaxStaleness)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cache.max_staleness in profile %q: %w", cfg.Profile, err)
+	}
+	return d, nil
+}
+
+// withCache wraps store with the encrypted vault cache unless it is
+// disabled by --no-cache or a zero TTL. The cache key is created on first
+// use and saved with the tokens. When offline is set, reads never reach
+// store.
+func withCache(cfg *config.Config, tokens *config.TokenData, owner string, store api.Store, offline bool) (api.Store, error) {
+	ttl, err := cacheTTL(cfg)
+	if err != nil {
+		return nil, err
+	}
+	staleness, err := maxStaleness(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if globalFlags.noCache || ttl <= 0 {
+		if offline {
+			return nil, fmt.Errorf("offline mode needs the local cache, which is disabled: %w", cache.ErrNoSnapshot)
+		}
+		return store, nil
+	}
+
+	if len(tokens.CacheKey) != cache.KeySize {
+		if tokens.CacheKey, err = cache.NewKey(); err != nil {
+			return nil, err
+		}
+		if err := cfg.SaveTokens(tokens); err != nil {
+			return nil, fmt.Errorf("failed to save cache key: %w", err)
+		}
+	}
+
+	path, err := cache.Path(cfg.Profile)
+	if err != nil {
+		return nil, err
+	}
+	return cache.New(store, cache.Options{
+		Path:  path,
+		Owner: owner,
+		Key:   tokens.CacheKey,
+		TTL:   ttl,
+
+		Offline:      offline,
+		MaxStaleness: staleness,
+		OnOffline:    warnOffline,
+	}), nil
+}
+
+// warnOffline tells the user that reads come from the local copy, and how
+// old it is
+func warnOffline(syncedAt time.Time, cause error) {
+	if cause != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  The API is unreachable (%v)\n", cause)
+	}
+	fmt.Fprintf(os.Stderr, "📴 Offline: using your vault as of %s (%s)\n",
+		relativeTime(syncedAt, time.Now()), syncedAt.Local().Format(time.DateTime))
+}
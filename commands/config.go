@@ -0,0 +1,182 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/owenHochwald/egg-carton/cli/config"
+	"github.com/spf13/cobra"
+)
+
+// ConfigCmd groups the commands that manage config.json
+var ConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage CLI configuration profiles",
+}
+
+// importTerraformCmd represents the config import-terraform command
+var importTerraformCmd = &cobra.Command{
+	Use:   "import-terraform <file|->",
+	Short: "Import deployment settings from 'terraform output -json'",
+	Long: `Read the JSON printed by 'terraform output -json' and store the
+EggCarton deployment settings in a profile.
+
+Example:
+  terraform output -json | egg config import-terraform -
+  egg --profile staging config import-terraform outputs.json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runImportTerraform,
+}
+
+// terraformOutputNames maps each profile setting to its Terraform output name
+var terraformOutputNames struct {
+	apiEndpoint string
+	userPoolID  string
+	clientID    string
+	domain      string
+	region      string
+}
+
+var importTerraformDryRun bool
+
+func init() {
+	flags := importTerraformCmd.Flags()
+	flags.StringVar(&terraformOutputNames.apiEndpoint, "api-endpoint-output", "api_endpoint", "output holding the API endpoint")
+	flags.StringVar(&terraformOutputNames.userPoolID, "user-pool-id-output", "cognito_user_pool_id", "output holding the Cognito user pool ID")
+	flags.StringVar(&terraformOutputNames.clientID, "client-id-output", "cognito_client_id", "output holding the Cognito app client ID")
+	flags.StringVar(&terraformOutputNames.domain, "domain-output", "cognito_domain", "output holding the Cognito domain")
+	flags.StringVar(&terraformOutputNames.region, "region-output", "cognito_region", "output holding the AWS region")
+	flags.BoolVar(&importTerraformDryRun, "dry-run", false, "show what would change without saving")
+
+	ConfigCmd.AddCommand(importTerraformCmd)
+}
+
+// terraformOutput is one entry of 'terraform output -json'
+type terraformOutput struct {
+	Sensitive bool `json:"sensitive"`
+	Value     any  `json:"value"`
+}
+
+func runImportTerraform(cmd *cobra.Command, args []string) error {
+	// 1. Read the Terraform outputs from a file or stdin
+	var input io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to open terraform outputs: %w", err)
+		}
+		defer f.Close()
+		input = f
+	}
+
+	var outputs map[string]terraformOutput
+	if err := json.NewDecoder(input).Decode(&outputs); err != nil {
+		return fmt.Errorf("failed to parse terraform outputs (expected 'terraform output -json'): %w", err)
+	}
+
+	// 2. Load the config file and pick the target profile
+	file, err := config.ReadConfigFile()
+	if err != nil {
+		return err
+	}
+	name, err := file.ResolveProfileName(globalFlags.profile)
+	if err != nil {
+		return err
+	}
+	profile, ok := file.Profiles[name]
+	if !ok {
+		profile = &config.Config{}
+		file.Profiles[name] = profile
+	}
+
+	// 3. Copy each mapped output into the profile, recording changes
+	fields := []struct {
+		setting string
+		output  string
+		target  *string
+	}{
+		{"api_endpoint", terraformOutputNames.apiEndpoint, &profile.APIEndpoint},
+		{"cognito.user_pool_id", terraformOutputNames.userPoolID, &profile.CognitoConfig.UserPoolID},
+		{"cognito.client_id", terraformOutputNames.clientID, &profile.CognitoConfig.ClientID},
+		{"cognito.region", terraformOutputNames.region, &profile.CognitoConfig.Region},
+		{"cognito.domain", terraformOutputNames.domain, &profile.CognitoConfig.Domain},
+	}
+
+	fmt.Printf("📥 Importing Terraform outputs into profile %q\n\n", name)
+	found, changed := 0, 0
+	for _, field := range fields {
+		output, ok := outputs[field.output]
+		if !ok {
+			fmt.Printf("   ? %-22s output %q not found, left as is\n", field.setting, field.output)
+			continue
+		}
+		value, ok := output.Value.(string)
+		if !ok {
+			return fmt.Errorf("terraform output %q is not a string", field.output)
+		}
+		found++
+
+		value = strings.TrimSpace(value)
+		if field.target == &profile.CognitoConfig.Domain {
+			value = normalizeCognitoDomain(value, profile.CognitoConfig.Region)
+		}
+
+		if *field.target == value {
+			fmt.Printf("   = %-22s unchanged\n", field.setting)
+			continue
+		}
+		fmt.Printf("   ~ %-22s %s → %s\n", field.setting, displaySetting(*field.target), value)
+		*field.target = value
+		changed++
+	}
+	fmt.Println()
+
+	if found == 0 {
+		return fmt.Errorf("none of the expected outputs were found; use the --*-output flags to map your output names")
+	}
+
+	// 4. Save unless this is a dry run
+	if importTerraformDryRun {
+		fmt.Printf("Dry run: %d setting(s) would change.\n", changed)
+		return nil
+	}
+	if changed == 0 {
+		fmt.Println("✅ Profile already up to date.")
+		return nil
+	}
+	if file.CurrentProfile == "" {
+		file.CurrentProfile = name
+	}
+	if err := file.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ Updated %d setting(s) in profile %q\n", changed, name)
+	if missing := profile.MissingFields(); len(missing) > 0 {
+		fmt.Printf("⚠️  Still missing: %s\n", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// normalizeCognitoDomain turns a bare Cognito domain prefix into the full
+// hosted UI host name and strips any scheme, since the token URLs add it
+func normalizeCognitoDomain(domain, region string) string {
+	domain = strings.TrimPrefix(domain, "https://")
+	domain = strings.TrimSuffix(domain, "/")
+	if !strings.Contains(domain, ".") && region != "" {
+		domain = fmt.Sprintf("%s.auth.%s.amazoncognito.com", domain, region)
+	}
+	return domain
+}
+
+// displaySetting shows an empty setting as "(unset)"
+func displaySetting(value string) string {
+	if value == "" {
+		return "(unset)"
+	}
+	return value
+}
@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// errNotConfirmed is returned when the user declines, or can't be asked
+var errNotConfirmed = errors.New("not confirmed")
+
+// confirm asks a yes/no question on the terminal. Without a terminal to
+// ask on it refuses rather than guess, so scripts must pass --yes.
+func confirm(cmd *cobra.Command, question string) error {
+	in, ok := cmd.InOrStdin().(*os.File)
+	if !ok || !isTerminal(in) {
+		return fmt.Errorf("%w: no terminal to ask on, pass --yes to go ahead", errNotConfirmed)
+	}
+
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Println()
+		return fmt.Errorf("%w: no answer", errNotConfirmed)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return fmt.Errorf("%w: aborted", errNotConfirmed)
+}
+
+// isTerminal reports whether f is an interactive terminal. The null
+// device is a character device too, but nobody is there to answer.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	if null, err := os.Stat(os.DevNull); err == nil && os.SameFile(info, null) {
+		return false
+	}
+	return true
+}
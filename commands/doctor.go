@@ -0,0 +1,434 @@
+package commands
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/owenHochwald/egg-carton/cli/config"
+	"github.com/owenHochwald/egg-carton/cli/httpclient"
+	"github.com/spf13/cobra"
+)
+
+// DoctorCmd represents the doctor command
+var DoctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose configuration, credentials and connectivity",
+	Long: `Run a series of checks against your configuration, stored credentials
+and network, and suggest a fix for anything that looks wrong.
+
+Use --json to produce a report you can attach to a support ticket.
+It never includes tokens or secret values.`,
+	Args: cobra.NoArgs,
+	RunE: runDoctor,
+}
+
+var doctorJSON bool
+
+func init() {
+	DoctorCmd.Flags().BoolVar(&doctorJSON, "json", false, "print the report as JSON")
+}
+
+// checkStatus is the outcome of one diagnostic check
+type checkStatus string
+
+const (
+	checkPass checkStatus = "pass"
+	checkWarn checkStatus = "warn"
+	checkFail checkStatus = "fail"
+)
+
+// addCheck records one check result
+type addCheck func(name string, status checkStatus, fix, format string, a ...any)
+
+// checkResult is one line of the doctor report
+type checkResult struct {
+	Name    string      `json:"name"`
+	Status  checkStatus `json:"status"`
+	Message string      `json:"message"`
+	Fix     string      `json:"fix,omitempty"`
+}
+
+// doctorReport is the full report printed by egg doctor
+type doctorReport struct {
+	Profile string        `json:"profile"`
+	OS      string        `json:"os"`
+	Arch    string        `json:"arch"`
+	Time    string        `json:"time"`
+	Checks  []checkResult `json:"checks"`
+}
+
+// add appends a check result to the report
+func (r *doctorReport) add(name string, status checkStatus, fix, format string, a ...any) {
+	r.Checks = append(r.Checks, checkResult{
+		Name:    name,
+		Status:  status,
+		Message: fmt.Sprintf(format, a...),
+		Fix:     fix,
+	})
+}
+
+// doctorTimeout bounds each network check
+const doctorTimeout = 5 * time.Second
+
+// maxClockSkew is the refresh buffer IsTokenValid relies on
+const maxClockSkew = 5 * time.Minute
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	report := &doctorReport{
+		OS:   runtime.GOOS,
+		Arch: runtime.GOARCH,
+		Time: time.Now().UTC().Format(time.RFC3339),
+	}
+	add := report.add
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	// 1. Config completeness
+	cfg, err := config.LoadProfileUnchecked(globalFlags.profile)
+	if err != nil {
+		add("config", checkFail, "fix or remove the config file, or select another profile with --profile", "%v", err)
+		return printDoctorReport(report)
+	}
+	report.Profile = cfg.Profile
+	if missing := cfg.MissingFields(); len(missing) > 0 {
+		add("config", checkFail, "run 'terraform output -json | egg config import-terraform -'",
+			"profile %q is missing %s", cfg.Profile, strings.Join(missing, ", "))
+	} else {
+		add("config", checkPass, "", "profile %q is complete", cfg.Profile)
+	}
+
+	// 2. Network settings (proxy, CA bundles, client certificate)
+	netOpts := networkOptions(cfg)
+	netOpts.Timeout = doctorTimeout
+	client, tlsConfig, proxy := checkNetworkSettings(netOpts, add)
+
+	// 3. Credential file permissions
+	checkCredentialPermissions(cfg, add)
+
+	// 4. Token validity and refreshability
+	checkTokens(cfg, add)
+
+	// 5-7. Endpoint reachability, clock skew and proxies
+	endpoints := []struct {
+		name    string
+		setting string
+		raw     string
+	}{
+		{"token endpoint", cfg.CognitoConfig.Domain, cfg.GetTokenURL()},
+		{"api endpoint", cfg.APIEndpoint, cfg.GetAPIBaseURL()},
+	}
+	skewChecked := false
+	for _, endpoint := range endpoints {
+		if endpoint.setting == "" {
+			add(endpoint.name, checkWarn, "complete the profile first", "skipped, not configured")
+			continue
+		}
+		u, err := url.Parse(endpoint.raw)
+		if err != nil || u.Host == "" {
+			add(endpoint.name, checkFail, "check the endpoint in your profile", "invalid URL %q", endpoint.raw)
+			continue
+		}
+		proxied := checkProxy(endpoint.name, u, proxy, add)
+		if checkReachable(ctx, endpoint.name, u, proxied, client, tlsConfig, add) && !skewChecked {
+			checkClockSkew(ctx, u, client, add)
+			skewChecked = true
+		}
+	}
+
+	// 8. Callback port for egg login
+	checkCallbackPort(cfg, add)
+
+	// An interrupted run still shows what it found, but exits as interrupted
+	if err := printDoctorReport(report); ctx.Err() == nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// checkNetworkSettings validates the profile's proxy and TLS settings and
+// returns what the network checks should use. Invalid settings are reported
+// and replaced by the defaults so the remaining checks can still run.
+func checkNetworkSettings(opts httpclient.Options, add addCheck) (*http.Client, *tls.Config, func(*http.Request) (*url.URL, error)) {
+	client, err := httpclient.New(opts)
+	if err != nil {
+		add("network", checkFail, "fix the network settings in your profile or the EGG_PROXY/EGG_CA_BUNDLE/EGG_CLIENT_* variables", "%v", err)
+		opts = httpclient.Options{UserAgent: opts.UserAgent, Timeout: opts.Timeout}
+		client, _ = httpclient.New(opts)
+	} else {
+		var custom []string
+		if opts.Proxy != "" {
+			custom = append(custom, "proxy "+opts.Proxy)
+		}
+		if len(opts.CABundles) > 0 {
+			custom = append(custom, plural(len(opts.CABundles), "extra CA bundle"))
+		}
+		if opts.ClientCert != "" {
+			custom = append(custom, "client certificate "+opts.ClientCert)
+		}
+		if len(custom) == 0 {
+			add("network", checkPass, "", "using the system proxy and CA settings")
+		} else {
+			add("network", checkPass, "", "using %s", strings.Join(custom, ", "))
+		}
+	}
+
+	tlsConfig, _ := opts.TLSConfig()
+	proxy, _ := opts.ProxyFunc()
+	return client, tlsConfig, proxy
+}
+
+// checkCredentialPermissions verifies credentials are private to the user
+func checkCredentialPermissions(cfg *config.Config, add addCheck) {
+	info, err := os.Stat(cfg.TokenPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		add("credentials", checkWarn, "run 'egg login'", "no credentials at %s", cfg.TokenPath)
+		return
+	}
+	if err != nil {
+		add("credentials", checkFail, "check the file exists and is readable", "%v", err)
+		return
+	}
+
+	if runtime.GOOS == "windows" {
+		add("credentials", checkPass, "", "found %s (permissions not checked on Windows)", cfg.TokenPath)
+		return
+	}
+
+	ok := true
+	if perm := info.Mode().Perm(); perm != 0600 {
+		add("credentials", checkFail, fmt.Sprintf("chmod 600 %s", cfg.TokenPath),
+			"%s has permissions %04o, want 0600", cfg.TokenPath, perm)
+		ok = false
+	}
+	dir := filepath.Dir(cfg.TokenPath)
+	if dirInfo, err := os.Stat(dir); err == nil && dirInfo.Mode().Perm() != 0700 {
+		add("credentials dir", checkFail, fmt.Sprintf("chmod 700 %s", dir),
+			"%s has permissions %04o, want 0700", dir, dirInfo.Mode().Perm())
+		ok = false
+	}
+	if ok {
+		add("credentials", checkPass, "", "%s is private (0600/0700)", cfg.TokenPath)
+	}
+}
+
+// checkTokens reports whether the session is usable. It only inspects the
+// stored tokens: refreshing them would change the credentials a diagnostic
+// is meant to look at.
+func checkTokens(cfg *config.Config, add addCheck) {
+	tokens, err := cfg.LoadTokens()
+	if errors.Is(err, fs.ErrNotExist) {
+		return // Already reported by the credentials check
+	}
+	if err != nil {
+		add("token", checkFail, "run 'egg login' to replace the credentials file", "%v", err)
+		return
+	}
+
+	expires := time.Unix(tokens.IssuedAt+int64(tokens.ExpiresIn), 0).Format(time.RFC3339)
+	switch {
+	case tokens.IsTokenValid():
+		add("token", checkPass, "", "access token valid until %s", expires)
+	case tokens.RefreshToken == "":
+		add("token", checkFail, "run 'egg login'", "access token expired at %s and there is no refresh token", expires)
+	case len(cfg.MissingFields()) > 0:
+		add("token", checkWarn, "complete the profile first", "access token expired at %s; it can't be refreshed until the profile is complete", expires)
+	default:
+		add("token", checkWarn, "run any egg command to refresh it, or 'egg login' if that fails", "access token expired at %s; a refresh token is stored, but whether it still works is not verified", expires)
+	}
+}
+
+// checkProxy reports which proxy, if any, requests to u go through
+func checkProxy(name string, u *url.URL, proxyFunc func(*http.Request) (*url.URL, error), add addCheck) bool {
+	if proxyFunc == nil {
+		add(name+" proxy", checkPass, "", "%s is reached directly (proxy: direct)", u.Host)
+		return false
+	}
+
+	proxy, err := proxyFunc(&http.Request{URL: u})
+	switch {
+	case err != nil:
+		add(name+" proxy", checkFail, "fix HTTPS_PROXY/HTTP_PROXY", "invalid proxy setting: %v", err)
+	case proxy == nil:
+		add(name+" proxy", checkPass, "", "%s is reached directly", u.Host)
+	default:
+		add(name+" proxy", checkPass, "", "%s is reached via proxy %s", u.Host, proxy.Redacted())
+		return true
+	}
+	return false
+}
+
+// checkReachable resolves the host and completes a TLS handshake with it.
+// Behind a proxy the host may not resolve locally, so a HEAD request through
+// the proxy is used instead.
+func checkReachable(ctx context.Context, name string, u *url.URL, proxied bool, client *http.Client, tlsConfig *tls.Config, add addCheck) bool {
+	if proxied {
+		resp, err := headRoot(ctx, client, u)
+		if err != nil {
+			add(name, checkFail, "check the proxy address, credentials and CA certificates", "cannot reach %s through the proxy: %v", u.Host, err)
+			return false
+		}
+		resp.Body.Close()
+		add(name, checkPass, "", "%s is reachable through the proxy", u.Host)
+		return true
+	}
+
+	host := u.Hostname()
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+		add(name, checkFail, "check the host name and your DNS/VPN settings", "cannot resolve %s: %v", host, err)
+		return false
+	}
+
+	dialer := &net.Dialer{Timeout: doctorTimeout}
+	if u.Scheme == "http" {
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+		if err != nil {
+			add(name, checkFail, "check your network, firewall or proxy", "cannot connect to %s: %v", u.Host, err)
+			return false
+		}
+		conn.Close()
+		add(name, checkWarn, "use an https:// endpoint", "%s is reachable but not using TLS", u.Host)
+		return true
+	}
+
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.ServerName = host
+	tlsDialer := &tls.Dialer{NetDialer: dialer, Config: tlsConfig}
+	conn, err := tlsDialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		add(name, checkFail, "check your network, firewall, proxy or CA certificates", "TLS handshake with %s failed: %v", u.Host, err)
+		return false
+	}
+	defer conn.Close()
+
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) > 0 && time.Until(certs[0].NotAfter) < 14*24*time.Hour {
+		add(name, checkWarn, "", "%s is reachable but its certificate expires %s", u.Host, certs[0].NotAfter.Format(time.RFC3339))
+		return true
+	}
+	add(name, checkPass, "", "%s resolves and completes a TLS handshake", u.Host)
+	return true
+}
+
+// checkClockSkew compares the local clock with the server's Date header
+func checkClockSkew(ctx context.Context, u *url.URL, client *http.Client, add addCheck) {
+	resp, err := headRoot(ctx, client, u)
+	if err != nil {
+		add("clock", checkWarn, "", "could not read server time: %v", err)
+		return
+	}
+	resp.Body.Close()
+
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		add("clock", checkWarn, "", "server did not send a usable Date header")
+		return
+	}
+
+	skew := time.Since(serverTime).Round(time.Second)
+	if skew < 0 {
+		skew = -skew
+	}
+	switch {
+	case skew >= maxClockSkew:
+		add("clock", checkFail, "enable automatic time sync (NTP)", "local clock is %s off from %s", skew, u.Host)
+	case skew >= 30*time.Second:
+		add("clock", checkWarn, "enable automatic time sync (NTP)", "local clock is %s off from %s", skew, u.Host)
+	default:
+		add("clock", checkPass, "", "local clock is within %s of %s", skew, u.Host)
+	}
+}
+
+// headRoot sends a HEAD request for the root of u's host
+func headRoot(ctx context.Context, client *http.Client, u *url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, fmt.Sprintf("%s://%s/", u.Scheme, u.Host), nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// checkCallbackPort makes sure egg login can listen for the OAuth redirect
+func checkCallbackPort(cfg *config.Config, add addCheck) {
+	u, err := url.Parse(cfg.GetRedirectURI())
+	if err != nil {
+		add("callback port", checkFail, "", "invalid redirect URI %q", cfg.GetRedirectURI())
+		return
+	}
+
+	listener, err := net.Listen("tcp", ":"+u.Port())
+	if err != nil {
+		add("callback port", checkFail, fmt.Sprintf("stop the process using port %s before running 'egg login'", u.Port()),
+			"port %s is not free: %v", u.Port(), err)
+		return
+	}
+	listener.Close()
+	add("callback port", checkPass, "", "port %s is free for the login callback", u.Port())
+}
+
+// printDoctorReport prints the report and fails if any check failed
+func printDoctorReport(report *doctorReport) error {
+	failed := 0
+	for _, check := range report.Checks {
+		if check.Status == checkFail {
+			failed++
+		}
+	}
+
+	if doctorJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode report: %w", err)
+		}
+	} else {
+		fmt.Printf("🩺 egg doctor (profile %q)\n\n", report.Profile)
+		for _, check := range report.Checks {
+			icon := "✅"
+			switch check.Status {
+			case checkWarn:
+				icon = "⚠️ "
+			case checkFail:
+				icon = "❌"
+			}
+			fmt.Printf("%s %-22s %s\n", icon, check.Name, check.Message)
+			if check.Fix != "" {
+				fmt.Printf("   %-22s → %s\n", "", check.Fix)
+			}
+		}
+		fmt.Println()
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	if !doctorJSON {
+		fmt.Println("🎉 Everything looks healthy!")
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package commands
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+	"github.com/spf13/cobra"
+)
+
+// EditCmd represents the edit command
+var EditCmd = &cobra.Command{
+	Use:   "edit <key>",
+	Short: "Edit a secret in your editor",
+	Long: `Open a secret in $VISUAL or $EDITOR (vi if neither is set) and store the
+result. A key that doesn't exist yet starts out empty.
+
+The new value is only stored if nobody changed the secret while you were
+editing. Otherwise you get a conflict showing both versions, and can edit
+the current one again.
+
+Example:
+  egg edit TLS_CERT
+  EDITOR="code --wait" egg edit CONFIG_JSON
+  egg edit -m "add staging host" CONFIG_JSON`,
+	Args: cobra.ExactArgs(1),
+	RunE: runEdit,
+}
+
+var editFlags struct {
+	message string
+}
+
+func init() {
+	EditCmd.Flags().StringVarP(&editFlags.message, "message", "m", "", "change note recorded in the secret's history")
+}
+
+func runEdit(cmd *cobra.Command, args []string) error {
+	key := args[0]
+	if err := api.ValidateSecretKey(key); err != nil {
+		return err
+	}
+
+	// 1. Load config, tokens and storage backend. Editing has no time
+	// limit, so only the network calls are bounded by --timeout.
+	readCtx, cancelRead := commandContext(cmd)
+	defer cancelRead()
+	sess, err := newSession(readCtx)
+	if err != nil {
+		return err
+	}
+
+	// 2. Read the current version from the backend, bypassing the cache
+	backend := sess.store
+	if sess.cache != nil {
+		backend = sess.cache.Unwrap()
+	}
+	var current api.GetEggResponse
+	egg, err := backend.GetEggByKey(readCtx, sess.owner, key)
+	switch {
+	case errors.Is(err, api.ErrNotFound):
+		fmt.Printf("🥚 %s doesn't exist yet; it will be created\n", key)
+	case err != nil:
+		return fmt.Errorf("failed to get egg: %w", err)
+	case egg.Version == 0:
+		return fmt.Errorf("the storage backend doesn't report versions, so %s can't be edited safely; use 'egg lay' instead", key)
+	default:
+		current = *egg
+	}
+
+	// 3. Let the user edit a private copy
+	edited, err := editValue(key, current.Plaintext)
+	if err != nil {
+		return err
+	}
+	if edited == current.Plaintext {
+		fmt.Printf("🤷 No changes to %s\n", key)
+		return nil
+	}
+	if edited == "" {
+		return errors.New("aborting: the new value is empty (use 'egg break' to delete a secret)")
+	}
+
+	// 4. Store it only if the secret is still at the version read
+	writeCtx, cancelWrite := commandContext(cmd)
+	defer cancelWrite()
+	ifMatch := api.Precondition{Version: current.Version, UpdatedAt: current.UpdatedAt}
+	req := api.PutEggRequest{SecretID: key, Plaintext: edited, Note: editFlags.message}
+	if err := putIfMatch(writeCtx, sess, req, ifMatch); err != nil {
+		if errors.Is(err, api.ErrConflict) {
+			fmt.Printf("💡 Your edit was not saved. Run 'egg edit %s' again to edit the current version.\n", key)
+		}
+		return fmt.Errorf("failed to save egg: %w", err)
+	}
+
+	fmt.Printf("✅ Saved %s\n", key)
+	return nil
+}
+
+// editValue opens value in the user's editor and returns the result. The
+// copy lives in a private temporary directory that is removed afterwards.
+func editValue(key, value string) (string, error) {
+	dir, err := os.MkdirTemp("", "egg-edit-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, key)
+	if err := os.WriteFile(path, []byte(value), 0600); err != nil {
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	// $EDITOR may carry arguments, e.g. "code --wait". A blank one counts
+	// as unset.
+	editor := strings.Fields(os.Getenv("VISUAL"))
+	if len(editor) == 0 {
+		editor = strings.Fields(os.Getenv("EDITOR"))
+	}
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+	editCmd := exec.Command(editor[0], append(editor[1:], path)...)
+	editCmd.Stdin = os.Stdin
+	editCmd.Stdout = os.Stdout
+	editCmd.Stderr = os.Stderr
+	if err := editCmd.Run(); err != nil {
+		return "", fmt.Errorf("editor %s failed: %w", editor[0], err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read temporary file: %w", err)
+	}
+
+	// Editors add a final newline; keep it only if the value had one
+	if !strings.HasSuffix(value, "\n") {
+		data = bytes.TrimSuffix(bytes.TrimSuffix(data, []byte("\n")), []byte("\r"))
+	}
+	return string(data), nil
+}
+
+// putIfMatch stores a secret only if it still matches ifMatch, for
+// backends that support it (see api.ConditionalStore)
+func putIfMatch(ctx context.Context, sess *session, req api.PutEggRequest, ifMatch api.Precondition) error {
+	store, ok := sess.store.(api.ConditionalStore)
+	if !ok {
+		return fmt.Errorf("the %q backend cannot check versions: %w", cmp.Or(sess.cfg.Backend, api.DefaultBackend), errors.ErrUnsupported)
+	}
+	return store.PutEggIfMatch(ctx, sess.owner, req, ifMatch)
+}
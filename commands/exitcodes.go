@@ -0,0 +1,67 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+	"github.com/owenHochwald/egg-carton/cli/auth"
+	"github.com/owenHochwald/egg-carton/cli/cache"
+)
+
+// Process exit codes. These are part of the CLI's public interface so that
+// scripts can branch on them; never renumber an existing code.
+const (
+	ExitOK           = 0
+	ExitError        = 1   // Any other failure
+	ExitNotFound     = 3   // The secret does not exist
+	ExitUnauthorized = 4   // Not logged in, or the session could not be refreshed
+	ExitForbidden    = 5   // Logged in but not allowed
+	ExitConflict     = 6   // The secret changed concurrently
+	ExitRateLimited  = 7   // Still throttled after retries
+	ExitValidation   = 8   // The API rejected the request as invalid
+	ExitServer       = 9   // The API failed (5xx) after retries
+	ExitNetwork      = 10  // The API could not be reached or timed out
+	ExitExpiring     = 11  // Secrets have expired or expire soon (egg expiring, hatch with on_expired: refuse)
+	ExitInterrupted  = 130 // Cancelled with Ctrl-C
+)
+
+// errNotLoggedIn is returned when no usable credentials are stored
+var errNotLoggedIn = errors.New("you are not logged in. Please run 'egg login' first")
+
+// ExitCode maps an error returned by a command to a process exit code
+func ExitCode(err error) int {
+	// Not net.Error: syscall.Errno implements it too, so a missing local
+	// file would count as a network failure
+	var urlErr *url.Error
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, context.Canceled):
+		return ExitInterrupted
+	case errors.Is(err, api.ErrNotFound):
+		return ExitNotFound
+	case errors.Is(err, api.ErrUnauthorized), errors.Is(err, errNotLoggedIn), errors.Is(err, auth.ErrTokenRejected):
+		return ExitUnauthorized
+	case errors.Is(err, api.ErrForbidden):
+		return ExitForbidden
+	case errors.Is(err, api.ErrConflict):
+		return ExitConflict
+	case errors.Is(err, api.ErrRateLimited):
+		return ExitRateLimited
+	case errors.Is(err, api.ErrValidation):
+		return ExitValidation
+	case errors.Is(err, api.ErrServer):
+		return ExitServer
+	case errors.Is(err, errExpiring):
+		return ExitExpiring
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, cache.ErrOffline), errors.Is(err, cache.ErrTooStale), errors.As(err, &urlErr), errors.As(err, &opErr), errors.As(err, &dnsErr):
+		return ExitNetwork
+	}
+	return ExitError
+}
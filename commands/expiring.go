@@ -0,0 +1,318 @@
+package commands
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+	"github.com/owenHochwald/egg-carton/cli/config"
+	"github.com/spf13/cobra"
+)
+
+// DefaultExpiryWarning is how long before a secret expires list and
+// expiring start pointing it out, unless expiry.warn_within says otherwise
+const DefaultExpiryWarning = 14 * 24 * time.Hour
+
+// errExpiring is returned when secrets have expired or are about to
+var errExpiring = errors.New("secrets are expiring")
+
+// ExpiringCmd represents the expiring command
+var ExpiringCmd = &cobra.Command{
+	Use:   "expiring",
+	Short: "List secrets that have expired, expire soon or are due for rotation",
+	Long: `List the secrets whose expiry date (set with 'egg lay --expires') has
+passed or falls within --within (expiry.warn_within, 14d by default).
+
+--rotation lists the secrets that are due for rotation instead: those
+whose last rotation (see 'egg rotate'), or creation if they were never
+rotated, is older than rotation.interval, or becomes so within --within.
+
+The exit code is 11 if any are found and 0 otherwise, so this can run in
+CI. --json prints a machine-readable list instead of a table.
+
+Example:
+  egg expiring
+  egg expiring --within 30d
+  egg expiring --within 14d --json
+  egg expiring --rotation`,
+	Args: cobra.NoArgs,
+	RunE: runExpiring,
+}
+
+var expiringFlags struct {
+	within   string
+	json     bool
+	rotation bool
+}
+
+func init() {
+	flags := ExpiringCmd.Flags()
+	flags.StringVar(&expiringFlags.within, "within", "", "how far ahead to look, e.g. 14d (default expiry.warn_within)")
+	flags.BoolVar(&expiringFlags.json, "json", false, "print JSON instead of a table")
+	flags.BoolVar(&expiringFlags.rotation, "rotation", false, "list secrets due for rotation (rotation.interval) instead")
+}
+
+// expiringSecret is one entry of 'egg expiring --json'. CI jobs parse it,
+// so fields may be added but never removed or changed.
+type expiringSecret struct {
+	SecretID  string `json:"secret_id"`
+	ExpiresAt string `json:"expires_at"`
+	Expired   bool   `json:"expired"`
+	OwnerTeam string `json:"owner_team,omitempty"`
+}
+
+// rotationDueSecret is one entry of 'egg expiring --rotation --json'
+type rotationDueSecret struct {
+	SecretID  string `json:"secret_id"`
+	DueAt     string `json:"due_at"`
+	Overdue   bool   `json:"overdue"`
+	RotatedAt string `json:"rotated_at,omitempty"` // Empty if it was never rotated
+	OwnerTeam string `json:"owner_team,omitempty"`
+}
+
+func runExpiring(cmd *cobra.Command, args []string) error {
+	now := time.Now()
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	// 1. Load config, tokens and storage backend
+	sess, err := newSession(ctx)
+	if err != nil {
+		return err
+	}
+	within, err := expiryWarning(sess.cfg)
+	if err != nil {
+		return err
+	}
+	if expiringFlags.within != "" {
+		if within, err = parseDuration(expiringFlags.within); err != nil {
+			return fmt.Errorf("invalid --within: %w", err)
+		}
+	}
+	if expiringFlags.rotation {
+		return listRotationDue(ctx, sess, now, within)
+	}
+
+	// 2. Stream metadata only, keeping the secrets that expire in time
+	found := []expiringSecret{}
+	for egg, err := range sess.store.AllEggMetadata(ctx, sess.owner) {
+		if err != nil {
+			return fmt.Errorf("failed to list eggs: %w", err)
+		}
+		expiresAt, ok := parseTimestamp(egg.ExpiresAt)
+		if !ok || expiresAt.After(now.Add(within)) {
+			continue
+		}
+		found = append(found, expiringSecret{
+			SecretID:  egg.SecretID,
+			ExpiresAt: expiresAt.UTC().Format(time.RFC3339),
+			Expired:   !expiresAt.After(now),
+			OwnerTeam: egg.OwnerTeam,
+		})
+	}
+	slices.SortFunc(found, func(a, b expiringSecret) int {
+		return cmp.Or(cmp.Compare(a.ExpiresAt, b.ExpiresAt), cmp.Compare(a.SecretID, b.SecretID))
+	})
+
+	// 3. Print them
+	if expiringFlags.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(found); err != nil {
+			return err
+		}
+	} else if len(found) == 0 {
+		fmt.Printf("✅ No secrets expire within %s\n", formatDuration(within))
+	} else {
+		fmt.Printf("⏳ %d secret(s) expired or expiring within %s:\n\n", len(found), formatDuration(within))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tEXPIRES\tTEAM")
+		for _, secret := range found {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", secret.SecretID, formatExpiry(secret.ExpiresAt, now, within), cmp.Or(secret.OwnerTeam, "-"))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(found) > 0 {
+		return fmt.Errorf("%d secret(s) expired or expiring within %s: %w", len(found), formatDuration(within), errExpiring)
+	}
+	return nil
+}
+
+// listRotationDue is 'egg expiring --rotation': it lists the secrets that
+// are due for rotation within the window
+func listRotationDue(ctx context.Context, sess *session, now time.Time, within time.Duration) error {
+	interval, err := rotationInterval(sess.cfg)
+	if err != nil {
+		return err
+	}
+	if interval == 0 {
+		return fmt.Errorf("--rotation needs rotation.interval in profile %q", sess.cfg.Profile)
+	}
+
+	found := []rotationDueSecret{}
+	for egg, err := range sess.store.AllEggMetadata(ctx, sess.owner) {
+		if err != nil {
+			return fmt.Errorf("failed to list eggs: %w", err)
+		}
+		dueAt, ok := rotationDue(egg, interval)
+		if !ok || dueAt.After(now.Add(within)) {
+			continue
+		}
+		found = append(found, rotationDueSecret{
+			SecretID:  egg.SecretID,
+			DueAt:     dueAt.UTC().Format(time.RFC3339),
+			Overdue:   !dueAt.After(now),
+			RotatedAt: egg.RotatedAt,
+			OwnerTeam: egg.OwnerTeam,
+		})
+	}
+	slices.SortFunc(found, func(a, b rotationDueSecret) int {
+		return cmp.Or(cmp.Compare(a.DueAt, b.DueAt), cmp.Compare(a.SecretID, b.SecretID))
+	})
+
+	if expiringFlags.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(found); err != nil {
+			return err
+		}
+	} else if len(found) == 0 {
+		fmt.Printf("✅ No secrets are due for rotation within %s\n", formatDuration(within))
+	} else {
+		fmt.Printf("🔁 %d secret(s) due for rotation within %s:\n\n", len(found), formatDuration(within))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tDUE\tLAST ROTATED\tTEAM")
+		for _, secret := range found {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", secret.SecretID, formatRotationDue(secret.DueAt, now), formatTimestamp(secret.RotatedAt, now), cmp.Or(secret.OwnerTeam, "-"))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(found) > 0 {
+		return fmt.Errorf("%d secret(s) due for rotation within %s: %w", len(found), formatDuration(within), errExpiring)
+	}
+	return nil
+}
+
+// expiryWarning returns expiry.warn_within
+func expiryWarning(cfg *config.Config) (time.Duration, error) {
+	if cfg.Expiry.WarnWithin == "" {
+		return DefaultExpiryWarning, nil
+	}
+	d, err := parseDuration(cfg.Expiry.WarnWithin)
+	if err != nil {
+		return 0, fmt.Errorf("invalid expiry.warn_within in profile %q: %w", cfg.Profile, err)
+	}
+	return d, nil
+}
+
+// rotationInterval returns rotation.interval, 0 if rotation reminders are off
+func rotationInterval(cfg *config.Config) (time.Duration, error) {
+	if cfg.Rotation.Interval == "" {
+		return 0, nil
+	}
+	d, err := parseDuration(cfg.Rotation.Interval)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid rotation.interval %q in profile %q: use a duration like 90d", cfg.Rotation.Interval, cfg.Profile)
+	}
+	return d, nil
+}
+
+// rotationDue returns when a secret is next due for rotation: interval
+// after its last rotation, or after its creation if it was never rotated.
+// It reports false when reminders are off or the API gives no dates.
+func rotationDue(egg api.EggMetadata, interval time.Duration) (time.Time, bool) {
+	if interval <= 0 {
+		return time.Time{}, false
+	}
+	last, ok := parseTimestamp(cmp.Or(egg.RotatedAt, egg.CreatedAt))
+	if !ok {
+		return time.Time{}, false
+	}
+	return last.Add(interval), true
+}
+
+// refuseExpired reports whether expiry.on_expired tells hatch to refuse
+// expired secrets rather than warn about them
+func refuseExpired(cfg *config.Config) (bool, error) {
+	switch cfg.Expiry.OnExpired {
+	case "", "warn":
+		return false, nil
+	case "refuse":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid expiry.on_expired %q in profile %q: use warn or refuse", cfg.Expiry.OnExpired, cfg.Profile)
+}
+
+// parseExpiry turns "90d" (from now) or "2027-01-01" (a date, local
+// midnight) into an expiry time
+func parseExpiry(value string, now time.Time) (time.Time, error) {
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339, value)
+	}
+	if err != nil {
+		d, durationErr := parseDuration(value)
+		if durationErr != nil {
+			return time.Time{}, fmt.Errorf("invalid expiry %q: use a duration like 90d or a date like 2027-01-01", value)
+		}
+		t = now.Add(d)
+	}
+	if !t.After(now) {
+		return time.Time{}, fmt.Errorf("invalid expiry %q: it is in the past", value)
+	}
+	return t, nil
+}
+
+// expiryFlag turns an --expires value into the API's RFC 3339 form; ""
+// stays "" (no expiry)
+func expiryFlag(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	t, err := parseExpiry(value, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
+
+// formatRotationDue renders when a secret is due for rotation
+func formatRotationDue(value string, now time.Time) string {
+	t, ok := parseTimestamp(value)
+	switch {
+	case !ok:
+		return cmp.Or(value, "-")
+	case !t.After(now):
+		return "❌ was due " + relativeTime(t, now)
+	}
+	return "⚠️  " + relativeTime(t, now)
+}
+
+// formatExpiry renders an expiry date with a marker once it is within
+// the warning window or has passed
+func formatExpiry(value string, now time.Time, warnWithin time.Duration) string {
+	t, ok := parseTimestamp(value)
+	switch {
+	case !ok:
+		return cmp.Or(value, "-")
+	case !t.After(now):
+		return "❌ expired " + relativeTime(t, now)
+	case t.Before(now.Add(warnWithin)):
+		return "⚠️  " + relativeTime(t, now)
+	}
+	return relativeTime(t, now)
+}
@@ -1,11 +1,12 @@
 package commands
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/owenHochwald/egg-carton/cli/api"
-	"github.com/owenHochwald/egg-carton/cli/auth"
-	"github.com/owenHochwald/egg-carton/cli/config"
 	"github.com/spf13/cobra"
 )
 
@@ -13,82 +14,128 @@ import (
 var GetCmd = &cobra.Command{
 	Use:   "get [key]",
 	Short: "Retrieve a secret",
-	Long:  `Decrypt and retrieve a secret from your EggCarton vault.`,
-	Args:  cobra.MaximumNArgs(1), // 0 or 1 args - if no key, list all
-	RunE:  runGet,
+	Long: `Decrypt and retrieve a secret from your EggCarton vault.
+
+--version N prints an earlier version of the secret, see 'egg history'.
+Without a key, --tag only lists secrets with the given tags.`,
+	Args: cobra.MaximumNArgs(1), // 0 or 1 args - if no key, list all
+	RunE: runGet,
 }
 
-func runGet(cmd *cobra.Command, args []string) error {
-	// 1. Load config
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
-	}
+var getFlags struct {
+	version int64
+	tags    []string
+}
 
-	// 2. Load tokens (check if logged in)
-	tokens, err := cfg.LoadTokens()
-	if err != nil {
-		return fmt.Errorf("you are not logged in. Please run 'egg login' first: %w", err)
-	}
+func init() {
+	GetCmd.Flags().Int64Var(&getFlags.version, "version", 0, "print this earlier version of the secret")
+	GetCmd.Flags().StringArrayVar(&getFlags.tags, "tag", nil, "only list secrets with this key=value tag, or just key (repeatable)")
+}
 
-	// 3. Check if token is valid (refresh if needed)
-	if !tokens.IsTokenValid() {
-		fmt.Println("⏰ Token expired, refreshing...")
-		newTokens, err := auth.RefreshAccessToken(cfg.GetTokenURL(), cfg.CognitoConfig.ClientID, tokens.RefreshToken)
-		if err != nil {
-			return fmt.Errorf("failed to refresh token: %w", err)
-		}
-		if err := cfg.SaveTokens(newTokens); err != nil {
-			return fmt.Errorf("failed to save refreshed tokens: %w", err)
-		}
-		tokens = newTokens
+func runGet(cmd *cobra.Command, args []string) error {
+	if cmd.Flags().Changed("version") && len(args) != 1 {
+		return errors.New("--version needs a key")
 	}
-
-	// 4. Extract owner from token
-	owner, err := cfg.GetOwner()
+	if len(getFlags.tags) > 0 && len(args) == 1 {
+		return errors.New("--tag filters the full listing; leave out the key")
+	}
+	tags, err := parseTags(getFlags.tags, true)
 	if err != nil {
-		return fmt.Errorf("failed to extract owner from token: %w", err)
+		return err
 	}
 
-	// 5. Create API client
-	client := api.NewClient(cfg.GetAPIBaseURL(), tokens.AccessToken)
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
 
-	// 6. Call GetEgg to get all eggs
-	eggs, err := client.GetEgg(owner)
+	// 1. Load config, tokens and storage backend
+	sess, err := newSession(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get eggs: %w", err)
+		return err
 	}
 
-	// 7. If a specific key was provided, find and print just that one
+	// 2. If a specific key was provided, fetch and print just that one
 	if len(args) == 1 {
 		key := args[0]
-		found := false
-		for _, egg := range eggs {
-			if egg.SecretID == key {
-				fmt.Printf("🥚 Secret: %s\n", key)
-				fmt.Printf("Value: %s\n", egg.Plaintext)
-				found = true
-				break
-			}
+		egg, err := getEgg(ctx, cmd, sess, key)
+		if errors.Is(err, api.ErrNotFound) && cmd.Flags().Changed("version") {
+			return fmt.Errorf("version %d of secret '%s' %w", getFlags.version, key, api.ErrNotFound)
 		}
-		if !found {
-			return fmt.Errorf("secret '%s' not found", key)
+		if errors.Is(err, api.ErrNotFound) {
+			return fmt.Errorf("secret '%s' %w", key, api.ErrNotFound)
 		}
-	} else {
-		// No key provided - list all secrets
-		if len(eggs) == 0 {
-			fmt.Println("No secrets found in your vault.")
-			return nil
+		if err != nil {
+			return fmt.Errorf("failed to get egg: %w", err)
 		}
 
-		fmt.Printf("🥚 Found %d secret(s):\n\n", len(eggs))
-		for _, egg := range eggs {
-			fmt.Printf("Key: %s\n", egg.SecretID)
-			fmt.Printf("Value: %s\n", egg.Plaintext)
-			fmt.Printf("Created: %s\n", egg.CreatedAt)
-			fmt.Println("---")
+		fmt.Printf("🥚 Secret: %s\n", key)
+		fmt.Printf("Value: %s\n", egg.Plaintext)
+		if egg.Version > 0 {
+			fmt.Printf("Version: %d\n", egg.Version)
 		}
+		printSecretMetadata(egg.SecretMetadata)
+		return nil
 	}
 
+	// 3. No key provided - stream all secrets page by page
+	count := 0
+	for egg, err := range sess.store.AllEggs(ctx, sess.owner) {
+		if err != nil {
+			return fmt.Errorf("failed to get eggs: %w", err)
+		}
+		if !egg.HasTags(tags) {
+			continue
+		}
+		if count == 0 {
+			fmt.Print("🥚 Your secrets:\n\n")
+		}
+		count++
+
+		fmt.Printf("Key: %s\n", egg.SecretID)
+		fmt.Printf("Value: %s\n", egg.Plaintext)
+		fmt.Printf("Created: %s\n", egg.CreatedAt)
+		if egg.Version > 0 {
+			fmt.Printf("Version: %d\n", egg.Version)
+		}
+		printSecretMetadata(egg.SecretMetadata)
+		fmt.Println("---")
+	}
+
+	if count == 0 {
+		fmt.Println("No secrets found in your vault.")
+		return nil
+	}
+	fmt.Printf("Found %d secret(s).\n", count)
+
 	return nil
 }
+
+// getEgg fetches the current version of a secret, or the one --version names
+func getEgg(ctx context.Context, cmd *cobra.Command, sess *session, key string) (*api.GetEggResponse, error) {
+	if !cmd.Flags().Changed("version") {
+		return sess.store.GetEggByKey(ctx, sess.owner, key)
+	}
+	store, err := historyStore(sess)
+	if err != nil {
+		return nil, err
+	}
+	return store.GetEggVersion(ctx, sess.owner, key, getFlags.version)
+}
+
+// printSecretMetadata prints the metadata fields that are set
+func printSecretMetadata(meta api.SecretMetadata) {
+	if meta.Description != "" {
+		fmt.Printf("Description: %s\n", meta.Description)
+	}
+	if meta.OwnerTeam != "" {
+		fmt.Printf("Owner team: %s\n", meta.OwnerTeam)
+	}
+	if len(meta.Tags) > 0 {
+		fmt.Printf("Tags: %s\n", formatTags(meta.Tags))
+	}
+	if meta.ExpiresAt != "" {
+		fmt.Printf("Expires: %s\n", formatExpiry(meta.ExpiresAt, time.Now(), 0))
+	}
+	if meta.RotatedAt != "" {
+		fmt.Printf("Rotated: %s\n", formatTimestamp(meta.RotatedAt, time.Now()))
+	}
+}
@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+	"github.com/owenHochwald/egg-carton/cli/config"
+	"github.com/spf13/cobra"
+)
+
+// defaultTimeout bounds all network calls made by one command
+const defaultTimeout = time.Minute
+
+// globalFlags holds the persistent flags shared by every command
+var globalFlags struct {
+	profile string
+	timeout time.Duration
+	retries int
+	debug   bool
+	noCache bool
+	offline bool
+}
+
+// AddGlobalFlags registers the persistent flags on the root command
+func AddGlobalFlags(root *cobra.Command) {
+	flags := root.PersistentFlags()
+	flags.StringVarP(&globalFlags.profile, "profile", "p", "",
+		"config profile to use (default $EGG_PROFILE, then current_profile)")
+	flags.DurationVar(&globalFlags.timeout, "timeout", envDuration("EGG_TIMEOUT", defaultTimeout),
+		"give up on network calls after this long, 0 to wait forever ($EGG_TIMEOUT)")
+	flags.IntVar(&globalFlags.retries, "retries", envInt("EGG_RETRIES", api.DefaultRetryPolicy.MaxAttempts-1),
+		"retry throttled or failed API calls this many times ($EGG_RETRIES)")
+	flags.BoolVar(&globalFlags.debug, "debug", envBool("EGG_DEBUG", false),
+		"log HTTP requests and responses to stderr, with secrets redacted ($EGG_DEBUG)")
+	flags.BoolVar(&globalFlags.noCache, "no-cache", envBool("EGG_NO_CACHE", false),
+		"don't read or write the encrypted local vault cache ($EGG_NO_CACHE)")
+	flags.BoolVar(&globalFlags.offline, "offline", envBool("EGG_OFFLINE", false),
+		"serve reads from the encrypted local copy without contacting the API ($EGG_OFFLINE)")
+}
+
+// retryPolicy returns the API retry policy selected by --retries
+func retryPolicy() api.RetryPolicy {
+	policy := api.DefaultRetryPolicy
+	policy.MaxAttempts = max(globalFlags.retries, 0) + 1
+	return policy
+}
+
+// envDuration reads a duration from the environment, falling back to def
+func envDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Ignoring invalid %s=%q: %v\n", key, value, err)
+		return def
+	}
+	return d
+}
+
+// envInt reads an integer from the environment, falling back to def
+func envInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Ignoring invalid %s=%q: %v\n", key, value, err)
+		return def
+	}
+	return n
+}
+
+// envBool reads a boolean from the environment, falling back to def
+func envBool(key string, def bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Ignoring invalid %s=%q: %v\n", key, value, err)
+		return def
+	}
+	return b
+}
+
+// loadConfig loads the profile selected by --profile
+func loadConfig() (*config.Config, error) {
+	return config.LoadProfile(globalFlags.profile)
+}
@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+	"github.com/spf13/cobra"
+)
+
+// HistoryCmd represents the history command
+var HistoryCmd = &cobra.Command{
+	Use:   "history <key>",
+	Short: "Show a secret's earlier versions",
+	Long: `List every version of a secret, newest first, with when it was written,
+by whom, and the change note given with 'egg lay -m'. Values are masked
+unless --reveal is given.
+
+Use 'egg get <key> --version N' to print one old value, and
+'egg rollback <key> --to N' to restore it.
+
+Example:
+  egg history API_KEY
+  egg history API_KEY --reveal`,
+	Args: cobra.ExactArgs(1),
+	RunE: runHistory,
+}
+
+var historyFlags struct {
+	reveal bool
+}
+
+func init() {
+	HistoryCmd.Flags().BoolVar(&historyFlags.reveal, "reveal", false, "show the value of every version")
+}
+
+// maskedValue stands in for values that are not revealed
+const maskedValue = "••••••"
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	key := args[0]
+	now := time.Now()
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	// 1. Load config, tokens and storage backend
+	sess, err := newSession(ctx)
+	if err != nil {
+		return err
+	}
+	store, err := historyStore(sess)
+	if err != nil {
+		return err
+	}
+
+	// 2. Stream the versions, newest first, into a table
+	count := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for version, err := range store.EggHistory(ctx, sess.owner, key, historyFlags.reveal) {
+		if errors.Is(err, api.ErrNotFound) {
+			return fmt.Errorf("secret '%s' %w", key, api.ErrNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get history: %w", err)
+		}
+		if count == 0 {
+			fmt.Printf("📜 History of %s:\n\n", key)
+			fmt.Fprintln(w, "VERSION\tWRITTEN\tAUTHOR\tSIZE\tVALUE\tNOTE")
+		}
+
+		number := strconv.FormatInt(version.Version, 10)
+		if count == 0 {
+			number += " (current)"
+		}
+		value := maskedValue
+		if historyFlags.reveal {
+			value = strconv.Quote(version.Plaintext)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			number,
+			formatTimestamp(version.WrittenAt, now),
+			cmp.Or(version.Author, "-"),
+			formatSize(version.Size),
+			value,
+			cmp.Or(version.Note, "-"),
+		)
+		count++
+	}
+
+	if count == 0 {
+		fmt.Printf("No history recorded for %s.\n", key)
+		return nil
+	}
+	return w.Flush()
+}
+
+// historyStore returns the session's store if its backend keeps earlier
+// versions (see api.HistoryStore)
+func historyStore(sess *session) (api.HistoryStore, error) {
+	store, ok := sess.store.(api.HistoryStore)
+	if !ok {
+		return nil, fmt.Errorf("the %q backend doesn't keep history: %w", cmp.Or(sess.cfg.Backend, api.DefaultBackend), errors.ErrUnsupported)
+	}
+	return store, nil
+}
@@ -0,0 +1,205 @@
+package commands
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+	"github.com/spf13/cobra"
+)
+
+// ListCmd represents the list command
+var ListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List secret names and metadata without their values",
+	Long: `List the keys in your EggCarton vault along with when they were created
+and updated, their version, size, expiry, owning team and tags. Values are
+never fetched or shown.
+
+Example:
+  egg list
+  egg list --sort updated --reverse
+  egg list --since 7d
+  egg list --tag env=prod --tag team`,
+	Args: cobra.NoArgs,
+	RunE: runList,
+}
+
+var listFlags struct {
+	sort     string
+	reverse  bool
+	since    string
+	absolute bool
+	tags     []string
+}
+
+func init() {
+	flags := ListCmd.Flags()
+	flags.StringVar(&listFlags.sort, "sort", "name", "sort by name, created, updated or size")
+	flags.BoolVarP(&listFlags.reverse, "reverse", "r", false, "reverse the sort order")
+	flags.StringVar(&listFlags.since, "since", "", "only show secrets changed since a duration (7d) or date (2026-01-02)")
+	flags.BoolVar(&listFlags.absolute, "absolute", false, "show absolute timestamps instead of relative ones")
+	flags.StringArrayVar(&listFlags.tags, "tag", nil, "only show secrets with this key=value tag, or just key (repeatable)")
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	now := time.Now()
+
+	// 1. Validate flags before touching the network
+	less, err := metadataOrder(listFlags.sort)
+	if err != nil {
+		return err
+	}
+	var since time.Time
+	if listFlags.since != "" {
+		if since, err = parseSince(listFlags.since, now); err != nil {
+			return err
+		}
+	}
+	tags, err := parseTags(listFlags.tags, true)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	// 2. Load config, tokens and storage backend
+	sess, err := newSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	// 3. Stream metadata only, keeping just the entries that pass the filter
+	var eggs []api.EggMetadata
+	for egg, err := range sess.store.AllEggMetadata(ctx, sess.owner) {
+		if err != nil {
+			return fmt.Errorf("failed to list eggs: %w", err)
+		}
+		if !since.IsZero() {
+			if changed, ok := lastChanged(egg); !ok || changed.Before(since) {
+				continue
+			}
+		}
+		if !egg.HasTags(tags) {
+			continue
+		}
+		eggs = append(eggs, egg)
+	}
+
+	// 4. Sort
+	sort.SliceStable(eggs, func(i, j int) bool {
+		if listFlags.reverse {
+			return less(eggs[j], eggs[i])
+		}
+		return less(eggs[i], eggs[j])
+	})
+
+	if len(eggs) == 0 {
+		fmt.Println("No secrets found in your vault.")
+		return nil
+	}
+
+	// 5. Print a table
+	warnWithin, err := expiryWarning(sess.cfg)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🥚 %d secret(s):\n\n", len(eggs))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVERSION\tSIZE\tUPDATED\tCREATED\tEXPIRES\tTEAM\tTAGS")
+	for _, egg := range eggs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			egg.SecretID,
+			formatVersion(egg.Version),
+			formatSize(egg.Size),
+			formatTimestamp(egg.UpdatedAt, now),
+			formatTimestamp(egg.CreatedAt, now),
+			formatExpiry(egg.ExpiresAt, now, warnWithin),
+			cmp.Or(egg.OwnerTeam, "-"),
+			formatTags(egg.Tags),
+		)
+	}
+	return w.Flush()
+}
+
+// metadataOrder returns the "less" function for a --sort value
+func metadataOrder(field string) (func(a, b api.EggMetadata) bool, error) {
+	switch field {
+	case "name":
+		return func(a, b api.EggMetadata) bool { return a.SecretID < b.SecretID }, nil
+	case "created":
+		return func(a, b api.EggMetadata) bool {
+			ta, _ := parseTimestamp(a.CreatedAt)
+			tb, _ := parseTimestamp(b.CreatedAt)
+			return ta.Before(tb)
+		}, nil
+	case "updated":
+		return func(a, b api.EggMetadata) bool {
+			ta, _ := lastChanged(a)
+			tb, _ := lastChanged(b)
+			return ta.Before(tb)
+		}, nil
+	case "size":
+		return func(a, b api.EggMetadata) bool { return a.Size < b.Size }, nil
+	}
+	return nil, fmt.Errorf("invalid --sort %q: use name, created, updated or size", field)
+}
+
+// lastChanged returns when a secret was last written
+func lastChanged(egg api.EggMetadata) (time.Time, bool) {
+	if t, ok := parseTimestamp(egg.UpdatedAt); ok {
+		return t, true
+	}
+	return parseTimestamp(egg.CreatedAt)
+}
+
+// formatTimestamp renders an API timestamp for display
+func formatTimestamp(value string, now time.Time) string {
+	t, ok := parseTimestamp(value)
+	switch {
+	case !ok && value == "":
+		return "-"
+	case !ok:
+		return value
+	case listFlags.absolute:
+		return t.Local().Format("2006-01-02 15:04")
+	}
+	return relativeTime(t, now)
+}
+
+// formatVersion renders a secret's version, "-" if the API doesn't report it
+func formatVersion(version int64) string {
+	if version == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(version, 10)
+}
+
+// formatSize renders a byte count
+func formatSize(n int) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f KiB", float64(n)/1024)
+}
+
+// formatTags renders tags as sorted k=v pairs
+func formatTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return "-"
+	}
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/owenHochwald/egg-carton/cli/auth"
-	"github.com/owenHochwald/egg-carton/cli/config"
 	"github.com/pkg/browser"
 	"github.com/spf13/cobra"
 )
@@ -18,18 +17,24 @@ var LoginCmd = &cobra.Command{
 	Long: `Opens your browser to authenticate with AWS Cognito.
 	
 Uses PKCE flow for secure authentication without client secrets.
-Tokens are stored locally in ~/.eggcarton/credentials.json`,
+Tokens are stored locally in $XDG_STATE_HOME/eggcarton/credentials.json
+(~/.local/state/eggcarton by default, or $EGG_HOME when set).`,
 	RunE: runLogin,
 }
 
 func runLogin(cmd *cobra.Command, args []string) error {
 	fmt.Println("🔐 Starting authentication flow...")
 
-	cfg, err := config.LoadConfig()
+	cfg, err := loadConfig()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		return err
+	}
+
 	existingTokens, _ := cfg.LoadTokens()
 	if existingTokens != nil && existingTokens.IsTokenValid() {
 		fmt.Println("You are already logged in!")
@@ -52,7 +57,8 @@ func runLogin(cmd *cobra.Command, args []string) error {
 
 	fmt.Printf("If browser doesn't open, visit:\n   %s\n\n", authURL)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	// Waiting for the browser is not bounded by --timeout, only by Ctrl-C
+	ctx, cancel := context.WithTimeout(cmd.Context(), 5*time.Minute)
 	defer cancel()
 
 	// Start server in background
@@ -81,7 +87,11 @@ func runLogin(cmd *cobra.Command, args []string) error {
 	fmt.Println("Authorization code received!")
 
 	fmt.Println("Exchanging code for tokens...")
+	exchangeCtx, cancelExchange := commandContext(cmd)
+	defer cancelExchange()
 	tokens, err := auth.ExchangeCodeForTokens(
+		exchangeCtx,
+		client,
 		cfg.GetTokenURL(),
 		cfg.CognitoConfig.ClientID,
 		authCode,
@@ -92,6 +102,11 @@ func runLogin(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to exchange code for tokens: %w", err)
 	}
 
+	// Writes queued while offline must survive logging in again
+	if existingTokens != nil {
+		tokens.OutboxKey = existingTokens.OutboxKey
+	}
+
 	if err := cfg.SaveTokens(tokens); err != nil {
 		return fmt.Errorf("failed to save tokens: %w", err)
 	}
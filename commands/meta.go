@@ -0,0 +1,192 @@
+package commands
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+	"github.com/spf13/cobra"
+)
+
+// MetaCmd groups the commands that read and change secret metadata
+var MetaCmd = &cobra.Command{
+	Use:   "meta",
+	Short: "Show or change a secret's description, owning team and tags",
+	Long: `Secrets can carry a description, an owning team, key=value tags and an
+expiry date, so others can tell what they are for. Metadata is set with
+'egg lay' or 'egg meta set', which changes it without touching the value
+or its version.
+
+Tags can be used to filter 'egg list', 'egg get' and 'egg hatch'.`,
+}
+
+// metaGetCmd represents the meta get command
+var metaGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Show a secret's metadata, never its value",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runMetaGet,
+}
+
+// metaSetCmd represents the meta set command
+var metaSetCmd = &cobra.Command{
+	Use:   "set <key>",
+	Short: "Change a secret's metadata without touching its value",
+	Long: `Change a secret's metadata. Only the fields given change; pass an empty
+--description, --owner-team or --expires to clear one.
+
+Example:
+  egg meta set LEGACY_TOKEN_2 --description "Webhook signing key for the old billing API"
+  egg meta set LEGACY_TOKEN_2 --owner-team billing --tag env=prod --untag deprecated
+  egg meta set TLS_CERT --expires 2027-03-01`,
+	Args: cobra.ExactArgs(1),
+	RunE: runMetaSet,
+}
+
+var metaSetFlags struct {
+	description string
+	ownerTeam   string
+	tags        []string
+	untags      []string
+	expires     string
+}
+
+func init() {
+	flags := metaSetCmd.Flags()
+	flags.StringVar(&metaSetFlags.description, "description", "", "what the secret is for")
+	flags.StringVar(&metaSetFlags.ownerTeam, "owner-team", "", "team responsible for the secret")
+	flags.StringArrayVar(&metaSetFlags.tags, "tag", nil, "add or change a key=value tag (repeatable)")
+	flags.StringArrayVar(&metaSetFlags.untags, "untag", nil, "remove a tag by key (repeatable)")
+	flags.StringVar(&metaSetFlags.expires, "expires", "", "when the secret expires: a duration like 90d or a date like 2027-01-01")
+
+	MetaCmd.AddCommand(metaGetCmd)
+	MetaCmd.AddCommand(metaSetCmd)
+}
+
+func runMetaGet(cmd *cobra.Command, args []string) error {
+	key := args[0]
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	// 1. Load config, tokens and storage backend
+	sess, err := newSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	// 2. Fetch the metadata only
+	meta, err := sess.store.GetEggMetadata(ctx, sess.owner, key)
+	if errors.Is(err, api.ErrNotFound) {
+		return fmt.Errorf("secret '%s' %w", key, api.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get egg metadata: %w", err)
+	}
+
+	warnWithin, err := expiryWarning(sess.cfg)
+	if err != nil {
+		return err
+	}
+	printMetadata(meta, time.Now(), warnWithin)
+	return nil
+}
+
+func runMetaSet(cmd *cobra.Command, args []string) error {
+	key := args[0]
+
+	// 1. Build the patch from the flags that were given
+	flags := cmd.Flags()
+	var patch api.MetadataPatch
+	if flags.Changed("description") {
+		patch.Description = &metaSetFlags.description
+	}
+	if flags.Changed("owner-team") {
+		patch.OwnerTeam = &metaSetFlags.ownerTeam
+	}
+	if flags.Changed("expires") {
+		expiresAt, err := expiryFlag(metaSetFlags.expires)
+		if err != nil {
+			return err
+		}
+		patch.ExpiresAt = &expiresAt
+	}
+	tags, err := parseTags(metaSetFlags.tags, false)
+	if err != nil {
+		return err
+	}
+	patch.SetTags = tags
+	for _, k := range metaSetFlags.untags {
+		if err := validateTagKey(k); err != nil {
+			return err
+		}
+		if _, ok := tags[k]; ok {
+			return fmt.Errorf("tag %s is both set and removed", k)
+		}
+	}
+	patch.RemoveTags = metaSetFlags.untags
+	if patch.Description == nil && patch.OwnerTeam == nil && patch.ExpiresAt == nil && len(patch.SetTags) == 0 && len(patch.RemoveTags) == 0 {
+		return errors.New("nothing to change: give --description, --owner-team, --tag, --untag or --expires")
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	// 2. Load config, tokens and storage backend
+	sess, err := newSession(ctx)
+	if err != nil {
+		return err
+	}
+	store, ok := sess.store.(api.MetadataStore)
+	if !ok {
+		return fmt.Errorf("the %q backend cannot update metadata: %w", cmp.Or(sess.cfg.Backend, api.DefaultBackend), errors.ErrUnsupported)
+	}
+
+	// 3. Apply it
+	meta, err := store.UpdateEggMetadata(ctx, sess.owner, key, patch)
+	if errors.Is(err, api.ErrNotFound) {
+		return fmt.Errorf("secret '%s' %w", key, api.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update egg metadata: %w", err)
+	}
+
+	fmt.Printf("✅ Updated metadata of %s\n", key)
+	warnWithin, err := expiryWarning(sess.cfg)
+	if err != nil {
+		return err
+	}
+	printMetadata(meta, time.Now(), warnWithin)
+	return nil
+}
+
+// metadataFromFlags builds the metadata given with lay, nil if none was
+func metadataFromFlags(description, ownerTeam string, tags []string, expires string) (*api.SecretMetadata, error) {
+	parsed, err := parseTags(tags, false)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt, err := expiryFlag(expires)
+	if err != nil {
+		return nil, err
+	}
+	if description == "" && ownerTeam == "" && len(parsed) == 0 && expiresAt == "" {
+		return nil, nil
+	}
+	return &api.SecretMetadata{Description: description, OwnerTeam: ownerTeam, Tags: parsed, ExpiresAt: expiresAt}, nil
+}
+
+// printMetadata prints a secret's metadata as aligned fields
+func printMetadata(meta *api.EggMetadata, now time.Time, warnWithin time.Duration) {
+	fmt.Printf("🏷️  %s\n", meta.SecretID)
+	fmt.Printf("   Description: %s\n", cmp.Or(meta.Description, "-"))
+	fmt.Printf("   Owner team:  %s\n", cmp.Or(meta.OwnerTeam, "-"))
+	fmt.Printf("   Tags:        %s\n", formatTags(meta.Tags))
+	fmt.Printf("   Expires:     %s\n", formatExpiry(meta.ExpiresAt, now, warnWithin))
+	fmt.Printf("   Rotated:     %s\n", formatTimestamp(meta.RotatedAt, now))
+	fmt.Printf("   Version:     %s\n", formatVersion(meta.Version))
+	fmt.Printf("   Size:        %s\n", formatSize(meta.Size))
+	fmt.Printf("   Updated:     %s\n", formatTimestamp(cmp.Or(meta.UpdatedAt, meta.CreatedAt), now))
+}
@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+	"github.com/owenHochwald/egg-carton/cli/config"
+	"github.com/owenHochwald/egg-carton/cli/httpclient"
+)
+
+// version is the CLI version reported in the User-Agent
+var version = "dev"
+
+// SetVersion records the CLI version; main calls it with the build version
+func SetVersion(v string) {
+	version = v
+}
+
+// networkOptions turns a profile's network settings into client options
+func networkOptions(cfg *config.Config) httpclient.Options {
+	opts := httpclient.Options{
+		Proxy:      cfg.Network.Proxy,
+		CABundles:  cfg.Network.CABundles,
+		ClientCert: cfg.Network.ClientCert,
+		ClientKey:  cfg.Network.ClientKey,
+		UserAgent:  httpclient.UserAgent(version),
+		Timeout:    api.DefaultTimeout,
+	}
+	if globalFlags.debug {
+		opts.Debug = os.Stderr
+	}
+	return opts
+}
+
+// newHTTPClient builds the client all of a command's outbound calls share
+func newHTTPClient(cfg *config.Config) (*http.Client, error) {
+	client, err := httpclient.New(networkOptions(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("invalid network settings in profile %q: %w", cfg.Profile, err)
+	}
+	return client, nil
+}
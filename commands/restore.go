@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+	"github.com/spf13/cobra"
+)
+
+// RestoreCmd represents the restore command
+var RestoreCmd = &cobra.Command{
+	Use:   "restore <key>",
+	Short: "Bring a deleted secret back from the trash",
+	Long: `Move a secret deleted with 'egg break' out of the trash, with the value
+and version it had. This fails if a secret with the same key has been
+stored since; break or rename that one first.
+
+Example:
+  egg trash list
+  egg restore OLD_TOKEN`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRestore,
+}
+
+func runRestore(cmd *cobra.Command, args []string) error {
+	key := args[0]
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	// 1. Load config, tokens and storage backend
+	sess, err := newSession(ctx)
+	if err != nil {
+		return err
+	}
+	trash, ok := trashStore(sess)
+	if !ok {
+		return fmt.Errorf("the %q backend has no trash: %w", cmp.Or(sess.cfg.Backend, api.DefaultBackend), errors.ErrUnsupported)
+	}
+
+	// 2. Restore it
+	err = trash.RestoreEgg(ctx, sess.owner, key)
+	switch {
+	case errors.Is(err, api.ErrNotFound):
+		return fmt.Errorf("secret '%s' is not in the trash: %w", key, api.ErrNotFound)
+	case errors.Is(err, api.ErrConflict):
+		return fmt.Errorf("cannot restore %s: a secret with that key exists: %w", key, api.ErrConflict)
+	case err != nil:
+		return fmt.Errorf("failed to restore egg: %w", err)
+	}
+
+	fmt.Printf("♻️  Restored %s from the trash\n", key)
+	return nil
+}
@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+	"github.com/spf13/cobra"
+)
+
+// RollbackCmd represents the rollback command
+var RollbackCmd = &cobra.Command{
+	Use:   "rollback <key> --to VERSION",
+	Short: "Restore an earlier version of a secret",
+	Long: `Store the value a secret had at an earlier version as its new current
+version. Nothing is deleted: the rollback is itself a new version, so it
+can be undone the same way. See 'egg history' for the version numbers.
+
+The rollback is only stored if nobody changed the secret in the meantime.
+
+Example:
+  egg rollback API_KEY --to 3
+  egg rollback API_KEY --to 3 -m "revert broken rotation"`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRollback,
+}
+
+var rollbackFlags struct {
+	to      int64
+	message string
+}
+
+func init() {
+	flags := RollbackCmd.Flags()
+	flags.Int64Var(&rollbackFlags.to, "to", 0, "version to restore (required)")
+	flags.StringVarP(&rollbackFlags.message, "message", "m", "", "change note recorded in the secret's history (default \"rollback to version N\")")
+	RollbackCmd.MarkFlagRequired("to")
+}
+
+func runRollback(cmd *cobra.Command, args []string) error {
+	key := args[0]
+	if rollbackFlags.to < 1 {
+		return fmt.Errorf("invalid --to %d: versions start at 1", rollbackFlags.to)
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	// 1. Load config, tokens and storage backend
+	sess, err := newSession(ctx)
+	if err != nil {
+		return err
+	}
+	store, err := historyStore(sess)
+	if err != nil {
+		return err
+	}
+
+	// 2. Read the current version from the backend rather than the cache,
+	// so the write below detects concurrent changes, then the old value
+	backend := sess.store
+	if sess.cache != nil {
+		backend = sess.cache.Unwrap()
+	}
+	current, err := backend.GetEggMetadata(ctx, sess.owner, key)
+	switch {
+	case errors.Is(err, api.ErrNotFound):
+		return fmt.Errorf("secret '%s' %w", key, api.ErrNotFound)
+	case err != nil:
+		return fmt.Errorf("failed to get egg metadata: %w", err)
+	case current.Version == 0:
+		return fmt.Errorf("the storage backend doesn't report versions, so %s can't be rolled back safely", key)
+	case current.Version == rollbackFlags.to:
+		fmt.Printf("🤷 %s is already at version %d\n", key, current.Version)
+		return nil
+	}
+	old, err := store.GetEggVersion(ctx, sess.owner, key, rollbackFlags.to)
+	if errors.Is(err, api.ErrNotFound) {
+		return fmt.Errorf("version %d of secret '%s' %w", rollbackFlags.to, key, api.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get version %d: %w", rollbackFlags.to, err)
+	}
+
+	// 3. Store it as a new version
+	req := api.PutEggRequest{
+		SecretID:  key,
+		Plaintext: old.Plaintext,
+		Note:      cmp.Or(rollbackFlags.message, fmt.Sprintf("rollback to version %d", rollbackFlags.to)),
+	}
+	ifMatch := api.Precondition{Version: current.Version, UpdatedAt: current.UpdatedAt}
+	if err := putIfMatch(ctx, sess, req, ifMatch); err != nil {
+		return fmt.Errorf("failed to roll back egg: %w", err)
+	}
+
+	fmt.Printf("⏪ Rolled %s back to version %d\n", key, rollbackFlags.to)
+	return nil
+}
@@ -0,0 +1,248 @@
+package commands
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+	"github.com/owenHochwald/egg-carton/cli/cache"
+	"github.com/owenHochwald/egg-carton/cli/config"
+	"github.com/spf13/cobra"
+)
+
+// defaultRotateLength is the length of values generated by 'egg rotate'
+const defaultRotateLength = 32
+
+// rotateCharsets are the alphabets --charset can pick
+var rotateCharsets = map[string]string{
+	"alnum":     "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789",
+	"hex":       "0123456789abcdef",
+	"base64url": "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_",
+}
+
+// RotateCmd represents the rotate command
+var RotateCmd = &cobra.Command{
+	Use:   "rotate <key>",
+	Short: "Replace a secret with a new random value via a rotator script",
+	Long: `Generate a new random value for a secret and hand it to a rotator: an
+executable that applies it to the system using the secret, e.g. by
+changing a database password. The rotator gets a JSON object with
+"secret_id", "old_value" and "new_value" on stdin. The new value is only
+stored if the rotator exits 0, and the time of the rotation is recorded
+in the secret's metadata.
+
+The rotator is --rotator, or else rotation.rotators[<key>] in the
+profile. With rotation.interval set, 'egg expiring --rotation' lists
+secrets that are due for rotation.
+
+Example:
+  egg rotate DB_PASSWORD
+  egg rotate DB_PASSWORD --rotator ~/bin/rotate-postgres
+  egg rotate WEBHOOK_SECRET --rotator "./rotate.sh --env prod" --charset hex --length 64`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRotate,
+}
+
+var rotateFlags struct {
+	rotator string
+	length  int
+	charset string
+	message string
+}
+
+func init() {
+	flags := RotateCmd.Flags()
+	flags.StringVar(&rotateFlags.rotator, "rotator", "", "command that applies the new value (default rotation.rotators[<key>])")
+	flags.IntVar(&rotateFlags.length, "length", defaultRotateLength, "length of the new value")
+	flags.StringVar(&rotateFlags.charset, "charset", "alnum", "characters of the new value: alnum, hex or base64url")
+	flags.StringVarP(&rotateFlags.message, "message", "m", "", "change note recorded in the secret's history (default \"rotated\")")
+}
+
+// rotatorInput is what a rotator reads on stdin
+type rotatorInput struct {
+	SecretID string `json:"secret_id"`
+	OldValue string `json:"old_value"`
+	NewValue string `json:"new_value"`
+}
+
+func runRotate(cmd *cobra.Command, args []string) error {
+	key := args[0]
+
+	// 1. Validate flags before touching the network
+	charset, ok := rotateCharsets[rotateFlags.charset]
+	if !ok {
+		return fmt.Errorf("invalid --charset %q: use alnum, hex or base64url", rotateFlags.charset)
+	}
+	if rotateFlags.length < 16 {
+		return fmt.Errorf("invalid --length %d: new values need at least 16 characters", rotateFlags.length)
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	// 2. Load config, tokens and storage backend, and find the rotator
+	sess, err := newSession(ctx)
+	if err != nil {
+		return err
+	}
+	rotator, err := rotatorFor(sess.cfg, key)
+	if err != nil {
+		return err
+	}
+
+	// 3. Read the current value from the backend rather than the cache, so
+	// the rotator is given what is actually in use
+	backend := sess.store
+	if sess.cache != nil {
+		backend = sess.cache.Unwrap()
+	}
+	current, err := backend.GetEggByKey(ctx, sess.owner, key)
+	if errors.Is(err, api.ErrNotFound) {
+		return fmt.Errorf("secret '%s' %w", key, api.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get egg: %w", err)
+	}
+
+	// 4. Generate the new value and hand both to the rotator
+	newValue := randomString(rotateFlags.length, charset)
+	fmt.Printf("🔁 Rotating %s with %s...\n", key, rotator[0])
+	if err := runRotator(cmd, rotator, rotatorInput{SecretID: key, OldValue: current.Plaintext, NewValue: newValue}); err != nil {
+		if cmd.Context() != nil && cmd.Context().Err() != nil {
+			return fmt.Errorf("rotator was interrupted, so whether it changed %s is unknown: %w", key, err)
+		}
+		return fmt.Errorf("rotator failed, %s was not changed: %w", key, err)
+	}
+
+	// 5. Store the new value, unless someone changed the secret while the
+	// rotator ran. The rotator may have taken a while, so the write gets a
+	// fresh timeout.
+	writeCtx, cancelWrite := commandContext(cmd)
+	defer cancelWrite()
+	req := api.PutEggRequest{
+		SecretID:       key,
+		Plaintext:      newValue,
+		Note:           cmp.Or(rotateFlags.message, "rotated"),
+		Metadata:       &api.SecretMetadata{RotatedAt: time.Now().UTC().Format(time.RFC3339)},
+		IdempotencyKey: rand.Text(),
+	}
+	if current.Version > 0 {
+		err = putIfMatch(writeCtx, sess, req, api.Precondition{Version: current.Version, UpdatedAt: current.UpdatedAt})
+	} else {
+		// Without versions the backend can't detect concurrent changes
+		err = sess.store.PutEgg(writeCtx, sess.owner, req)
+	}
+	if err == nil {
+		fmt.Printf("✅ Rotated %s\n", key)
+		return nil
+	}
+
+	// 6. The rotator already switched the system over, so the new value
+	// must not be lost. Queue it instead, never printing it.
+	op := cache.Op{ID: req.IdempotencyKey, Kind: cache.OpPut, SecretID: key, Plaintext: req.Plaintext, Note: req.Note, Metadata: req.Metadata, Base: current.Revision()}
+	if saveErr := saveRotated(sess, op); saveErr != nil {
+		fmt.Fprintf(os.Stderr, "🚨 The rotator applied a new value to %s, but it could not be stored (%v)\n", key, err)
+		fmt.Fprintf(os.Stderr, "   or queued in the encrypted outbox (%v). It is not kept anywhere else.\n", saveErr)
+		revealRotated(cmd, key, newValue)
+		return fmt.Errorf("failed to store rotated egg: %w", err)
+	}
+	switch {
+	case errors.Is(err, cache.ErrOffline) || api.IsUnavailable(err):
+		printQueued(op)
+		return nil
+	case errors.Is(err, api.ErrConflict):
+		fmt.Fprintf(os.Stderr, "🚨 %s changed while the rotator ran, so the new value was queued in the encrypted outbox instead.\n", key)
+		fmt.Fprintln(os.Stderr, "   Check the secret, then run 'egg sync --push --force' to store the rotated value.")
+	default:
+		fmt.Fprintf(os.Stderr, "🚨 The rotator applied a new value to %s, but it could not be stored, so it was queued in the encrypted outbox.\n", key)
+		fmt.Fprintln(os.Stderr, "   Run 'egg sync --push' to store it once the problem is fixed.")
+	}
+	return fmt.Errorf("failed to store rotated egg: %w", err)
+}
+
+// saveRotated keeps a rotated value that could not be stored in the
+// encrypted outbox, so 'egg sync --push' can store it later
+func saveRotated(sess *session, op cache.Op) error {
+	op.QueuedAt = time.Now().UTC()
+	outbox, err := sess.outbox(true)
+	if err != nil {
+		return err
+	}
+	if err := outbox.Add(op); err != nil {
+		return err
+	}
+	if sess.cache != nil {
+		sess.cache.ApplyQueued(op)
+	}
+	return nil
+}
+
+// revealRotated is the last resort for a rotated value that could be
+// neither stored nor queued: it is shown once on the terminal, and only if
+// the user asks for it. Without a terminal the value is lost, and the
+// rotation has to be repaired by hand.
+func revealRotated(cmd *cobra.Command, key, value string) {
+	if !isTerminal(os.Stderr) {
+		fmt.Fprintln(os.Stderr, "   No terminal to show it on: reset the credential by hand, then run 'egg lay' with it.")
+		return
+	}
+	if err := confirm(cmd, fmt.Sprintf("Show the new value of %s so you can store it yourself?", key)); err != nil {
+		fmt.Fprintln(os.Stderr, "   Not shown: reset the credential by hand, then run 'egg lay' with it.")
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s=%s\n", key, value)
+}
+
+// rotatorFor returns the rotator command for key, split into arguments
+func rotatorFor(cfg *config.Config, key string) ([]string, error) {
+	command := cmp.Or(rotateFlags.rotator, cfg.Rotation.Rotators[key])
+	rotator := strings.Fields(command)
+	if len(rotator) == 0 {
+		return nil, fmt.Errorf("no rotator for %s: pass --rotator or set rotation.rotators.%s in profile %q", key, key, cfg.Profile)
+	}
+	return rotator, nil
+}
+
+// runRotator runs the rotator with input as JSON on stdin, passing its
+// output through
+func runRotator(cmd *cobra.Command, rotator []string, input rotatorInput) error {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rotator input: %w", err)
+	}
+
+	// Neither --timeout nor Ctrl-C kills the rotator: stopping it halfway
+	// through changing a password would leave the system in an unknown
+	// state. A rotator run from a terminal still gets the Ctrl-C itself and
+	// can decide how to stop cleanly.
+	rotatorCmd := exec.Command(rotator[0], rotator[1:]...)
+	rotatorCmd.Stdin = bytes.NewReader(data)
+	rotatorCmd.Stdout = os.Stdout
+	rotatorCmd.Stderr = os.Stderr
+	return rotatorCmd.Run()
+}
+
+// randomString returns n characters drawn uniformly from charset
+func randomString(n int, charset string) string {
+	// Rejection sampling keeps every character equally likely
+	limit := 256 - 256%len(charset)
+	out := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(out) < n {
+		rand.Read(buf)
+		for _, b := range buf {
+			if int(b) < limit && len(out) < n {
+				out = append(out, charset[int(b)%len(charset)])
+			}
+		}
+	}
+	return string(out)
+}
@@ -4,11 +4,11 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/owenHochwald/egg-carton/cli/api"
-	"github.com/owenHochwald/egg-carton/cli/auth"
-	"github.com/owenHochwald/egg-carton/cli/config"
 	"github.com/spf13/cobra"
 )
 
@@ -22,74 +22,109 @@ var RunCmd = &cobra.Command{
 Example:
   egg hatch -- go run main.go
   egg hatch -- npm start
-  egg hatch -- ./my-script.sh`,
+  egg hatch -- ./my-script.sh
+  egg hatch -k DB_HOST,DB_PASS -- ./migrate.sh
+  egg hatch --tag env=prod -- ./deploy.sh`,
 	RunE: runRun,
-	// DisableFlagParsing allows passing flags to the subprocess
-	DisableFlagParsing: true,
 }
 
-func runRun(cmd *cobra.Command, args []string) error {
-	// 1. Load config
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
-	}
+var (
+	hatchKeys []string
+	hatchTags []string
+)
+
+func init() {
+	RunCmd.Flags().StringSliceVarP(&hatchKeys, "key", "k", nil, "only inject these secrets (repeatable or comma-separated)")
+	RunCmd.Flags().StringArrayVar(&hatchTags, "tag", nil, "only inject secrets with this key=value tag, or just key (repeatable)")
+
+	// Everything after "--" belongs to the subprocess, flags included
+	RunCmd.Flags().SetInterspersed(false)
+}
 
-	// 2. Load tokens (check if logged in)
-	tokens, err := cfg.LoadTokens()
+func runRun(cmd *cobra.Command, args []string) error {
+	tags, err := parseTags(hatchTags, true)
 	if err != nil {
-		return fmt.Errorf("you are not logged in. Please run 'egg login' first: %w", err)
+		return err
 	}
 
-	// 3. Check if token is valid (refresh if needed)
-	if !tokens.IsTokenValid() {
-		fmt.Println("⏰ Token expired, refreshing...")
-		newTokens, err := auth.RefreshAccessToken(cfg.GetTokenURL(), cfg.CognitoConfig.ClientID, tokens.RefreshToken)
-		if err != nil {
-			return fmt.Errorf("failed to refresh token: %w", err)
-		}
-		if err := cfg.SaveTokens(newTokens); err != nil {
-			return fmt.Errorf("failed to save refreshed tokens: %w", err)
-		}
-		tokens = newTokens
-	}
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
 
-	// 4. Extract owner from token
-	owner, err := cfg.GetOwner()
+	// 1. Load config, tokens and storage backend
+	sess, err := newSession(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to extract owner from token: %w", err)
+		return err
 	}
-
-	// 5. Create API client and fetch ALL secrets
-	client := api.NewClient(cfg.GetAPIBaseURL(), tokens.AccessToken)
-	eggs, err := client.GetEgg(owner)
+	refuse, err := refuseExpired(sess.cfg)
 	if err != nil {
-		return fmt.Errorf("failed to get eggs: %w", err)
+		return err
 	}
 
-	// 6. Parse secrets into environment variables
+	// 2. Fetch only the requested secrets, or stream ALL of them, and parse
+	// them into environment variables
 	secretEnvVars := make(map[string]string)
-	for _, egg := range eggs {
+	sources := make(map[string]string) // Environment variable -> secret ID
+	var expired, collisions []string
+	now := time.Now()
+	addSecret := func(egg api.GetEggResponse) {
+		if !egg.HasTags(tags) {
+			return
+		}
+		if expiresAt, ok := parseTimestamp(egg.ExpiresAt); ok && !expiresAt.After(now) {
+			expired = append(expired, fmt.Sprintf("%s (expired %s)", egg.SecretID, relativeTime(expiresAt, now)))
+		}
 		// Convert secret_id to uppercase env var format (e.g., api_key -> API_KEY)
 		envVarName := strings.ToUpper(egg.SecretID)
+		if other, ok := sources[envVarName]; ok && other != egg.SecretID {
+			collisions = append(collisions, fmt.Sprintf("%s and %s are both %s", other, egg.SecretID, envVarName))
+			return
+		}
+		sources[envVarName] = egg.SecretID
 		secretEnvVars[envVarName] = egg.Plaintext
 	}
 
-	// 7. Find the "--" separator in args
-	dashIndex := -1
-	for i, arg := range args {
-		if arg == "--" {
-			dashIndex = i
-			break
+	if len(hatchKeys) > 0 {
+		eggs, err := sess.store.GetEggsByKeys(ctx, sess.owner, hatchKeys)
+		if err != nil {
+			return fmt.Errorf("failed to get eggs: %w", err)
+		}
+		for _, egg := range eggs {
+			addSecret(egg)
+		}
+	} else {
+		for egg, err := range sess.store.AllEggs(ctx, sess.owner) {
+			if err != nil {
+				return fmt.Errorf("failed to get eggs: %w", err)
+			}
+			addSecret(egg)
+		}
+	}
+
+	// Keys that differ only in case would silently overwrite each other
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return fmt.Errorf("secrets clash as environment variables (%s): rename one, or pick one with --key", strings.Join(collisions, "; "))
+	}
+
+	// 3. Warn about expired secrets, or refuse them if expiry.on_expired says so
+	if len(expired) > 0 {
+		sort.Strings(expired)
+		if refuse {
+			return fmt.Errorf("refusing to hatch expired secrets: %s (expiry.on_expired is refuse): %w", strings.Join(expired, ", "), errExpiring)
+		}
+		for _, secret := range expired {
+			fmt.Fprintf(os.Stderr, "⚠️  Injecting expired secret %s\n", secret)
 		}
 	}
 
-	if dashIndex == -1 || dashIndex == len(args)-1 {
+	// 4. Find the "--" separator in args (cobra strips it and records where it was)
+	dashIndex := cmd.ArgsLenAtDash()
+	if dashIndex == -1 || dashIndex == len(args) {
 		return fmt.Errorf("usage: egg hatch -- <command> [args...]")
 	}
 
-	// 8. Extract command and arguments after "--"
-	commandArgs := args[dashIndex+1:]
+	// 5. Extract command and arguments after "--"
+	commandArgs := args[dashIndex:]
 	if len(commandArgs) == 0 {
 		return fmt.Errorf("no command specified after '--'")
 	}
@@ -97,10 +132,10 @@ func runRun(cmd *cobra.Command, args []string) error {
 	commandName := commandArgs[0]
 	commandArguments := commandArgs[1:]
 
-	// 9. Get current environment variables
+	// 6. Get current environment variables
 	currentEnv := os.Environ()
 
-	// 10. Merge secrets into environment
+	// 7. Merge secrets into environment
 	mergedEnv := append([]string{}, currentEnv...)
 	for key, value := range secretEnvVars {
 		mergedEnv = append(mergedEnv, fmt.Sprintf("%s=%s", key, value))
@@ -112,17 +147,17 @@ func runRun(cmd *cobra.Command, args []string) error {
 	}
 	fmt.Println()
 
-	// 11. Create exec.Command with custom environment
+	// 8. Create exec.Command with custom environment
 	command := exec.Command(commandName, commandArguments...)
 	command.Env = mergedEnv
 	command.Stdin = os.Stdin
 	command.Stdout = os.Stdout
 	command.Stderr = os.Stderr
 
-	// 12. Run command and wait
+	// 9. Run command and wait
 	if err := command.Run(); err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
-			// 13. Exit with same code as subprocess
+			// 10. Exit with same code as subprocess
 			os.Exit(exitErr.ExitCode())
 		}
 		return fmt.Errorf("failed to run command: %w", err)
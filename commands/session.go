@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+	"github.com/owenHochwald/egg-carton/cli/auth"
+	"github.com/owenHochwald/egg-carton/cli/cache"
+	"github.com/owenHochwald/egg-carton/cli/config"
+	"github.com/spf13/cobra"
+)
+
+// session holds everything an authenticated command needs
+type session struct {
+	cfg    *config.Config
+	tokens *config.TokenData
+	owner  string
+	client *http.Client
+	store  api.Store
+	cache  *cache.Store // nil when the cache is disabled
+}
+
+// newSession loads the config and tokens, refreshes the access token if it
+// has expired, and opens the profile's storage backend for the logged-in user
+func newSession(ctx context.Context) (*session, error) {
+	// 1. Load config
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Load tokens (check if logged in)
+	tokens, err := cfg.LoadTokens()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errNotLoggedIn, err)
+	}
+
+	// 3. Check if token is valid (refresh if needed). Offline, the expired
+	// token still unlocks the local copy.
+	offline := globalFlags.offline
+	if !tokens.IsTokenValid() && !offline {
+		fmt.Fprintln(os.Stderr, "⏰ Token expired, refreshing...")
+		newTokens, err := auth.RefreshAccessToken(ctx, client, cfg.GetTokenURL(), cfg.CognitoConfig.ClientID, tokens.RefreshToken)
+		switch {
+		case api.IsUnavailable(err):
+			fmt.Fprintf(os.Stderr, "⚠️  Could not refresh your session (%v)\n", err)
+			offline = true
+		case err != nil:
+			return nil, fmt.Errorf("failed to refresh token: %w", err)
+		default:
+			newTokens.CacheKey = tokens.CacheKey
+			newTokens.OutboxKey = tokens.OutboxKey
+			if err := cfg.SaveTokens(newTokens); err != nil {
+				return nil, fmt.Errorf("failed to save refreshed tokens: %w", err)
+			}
+			tokens = newTokens
+		}
+	}
+
+	// 4. Extract owner from token
+	owner, err := cfg.GetOwner()
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract owner from token: %w", err)
+	}
+
+	// 5. Open the storage backend chosen by the profile
+	store, err := api.OpenStore(cfg.Backend, api.BackendOptions{
+		Endpoint:    cfg.GetAPIBaseURL(),
+		AccessToken: tokens.AccessToken,
+		Settings:    cfg.BackendSettings,
+		HTTPClient:  client,
+		RetryPolicy: retryPolicy(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backend: %w", err)
+	}
+
+	// 6. Serve reads from the encrypted local cache unless it is disabled
+	if store, err = withCache(cfg, tokens, owner, store, offline); err != nil {
+		return nil, err
+	}
+
+	sess := &session{
+		cfg:    cfg,
+		tokens: tokens,
+		owner:  owner,
+		client: client,
+		store:  store,
+	}
+	sess.cache, _ = store.(*cache.Store)
+	return sess, nil
+}
+
+// commandContext returns the context for a command's network calls. It is
+// cancelled on Ctrl-C and bounded by --timeout.
+func commandContext(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if globalFlags.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, globalFlags.timeout)
+}
@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/owenHochwald/egg-carton/cli/cache"
+	"github.com/owenHochwald/egg-carton/cli/config"
+	"github.com/spf13/cobra"
+)
+
+// StatusCmd represents the status command
+var StatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show your session, local copy and queued changes",
+	Long: `Show who you are logged in as, how fresh the local copy of your vault
+is, and which changes made while offline are waiting for 'egg sync --push'.
+
+status never contacts the API, so it works offline.`,
+	Args: cobra.NoArgs,
+	RunE: runStatus,
+}
+
+func runStatus(cmd *cobra.Command, args []string) error {
+	now := time.Now()
+
+	// 1. Load config and tokens
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	fmt.Printf("🧭 Profile %q\n", cfg.Profile)
+
+	tokens, err := cfg.LoadTokens()
+	if err != nil {
+		fmt.Println("   Session:    not logged in")
+		return nil
+	}
+	owner, err := cfg.GetOwner()
+	if err != nil {
+		return fmt.Errorf("failed to extract owner from token: %w", err)
+	}
+
+	// 2. Session
+	expiresAt := time.Unix(tokens.IssuedAt+int64(tokens.ExpiresIn), 0)
+	if tokens.IsTokenValid() {
+		fmt.Printf("   Session:    %s, expires %s\n", owner, relativeTime(expiresAt, now))
+	} else {
+		fmt.Printf("   Session:    %s, expired (refreshed on next use)\n", owner)
+	}
+
+	// 3. Local copy of the vault
+	fmt.Printf("   Local copy: %s\n", describeLocalCopy(cfg, tokens, owner, now))
+
+	// 4. Changes queued while offline
+	if len(tokens.OutboxKey) != cache.KeySize {
+		fmt.Println("📭 No queued changes")
+		return nil
+	}
+	path, err := cache.OutboxPath(cfg.Profile)
+	if err != nil {
+		return err
+	}
+	ops, err := cache.OpenOutbox(path, owner, tokens.OutboxKey).Pending()
+	if err != nil {
+		return err
+	}
+	if len(ops) == 0 {
+		fmt.Println("📭 No queued changes")
+		return nil
+	}
+
+	fmt.Printf("📮 %d change(s) queued while offline (run 'egg sync --push'):\n", len(ops))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, op := range ops {
+		fmt.Fprintf(w, "   %s\t%s\tqueued %s\n", op.Kind, op.SecretID, relativeTime(op.QueuedAt, now))
+	}
+	return w.Flush()
+}
+
+// describeLocalCopy summarizes the cached vault without contacting the API
+func describeLocalCopy(cfg *config.Config, tokens *config.TokenData, owner string, now time.Time) string {
+	if ttl, err := cacheTTL(cfg); err != nil || ttl <= 0 {
+		return "disabled"
+	}
+	if len(tokens.CacheKey) != cache.KeySize {
+		return "none yet"
+	}
+
+	path, err := cache.Path(cfg.Profile)
+	if err != nil {
+		return err.Error()
+	}
+	snapshot, err := cache.LoadSnapshot(path, owner, tokens.CacheKey)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return "none yet"
+	case err != nil:
+		return fmt.Sprintf("unreadable (%v)", err)
+	}
+
+	summary := fmt.Sprintf("%d secret(s), synced %s (%s)", len(snapshot.Eggs),
+		relativeTime(snapshot.FetchedAt, now), snapshot.FetchedAt.Local().Format(time.DateTime))
+	if staleness, err := maxStaleness(cfg); err == nil && staleness > 0 && now.Sub(snapshot.FetchedAt) > staleness {
+		summary += ", too old to use offline"
+	}
+	return summary
+}
@@ -0,0 +1,214 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+	"github.com/owenHochwald/egg-carton/cli/cache"
+	"github.com/spf13/cobra"
+)
+
+// SyncCmd represents the sync command
+var SyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Update the local copy of your vault and push queued changes",
+	Long: `Download your vault into the encrypted local copy now, so it is fresh
+before you go offline.
+
+lay and break made while offline are queued in an encrypted outbox. --push
+replays them in order first. A queued change is only applied if the secret
+hasn't changed on the server since it was queued; conflicting changes stay
+queued until you push them again with --force, or drop them with --discard.
+
+Example:
+  egg sync
+  egg sync --push
+  egg sync --push --force`,
+	Args: cobra.NoArgs,
+	RunE: runSync,
+}
+
+var syncFlags struct {
+	push    bool
+	force   bool
+	discard bool
+}
+
+func init() {
+	flags := SyncCmd.Flags()
+	flags.BoolVar(&syncFlags.push, "push", false, "replay changes queued while offline")
+	flags.BoolVar(&syncFlags.force, "force", false, "with --push, apply queued changes even if they conflict")
+	flags.BoolVar(&syncFlags.discard, "discard", false, "drop every queued change without applying it")
+	SyncCmd.MarkFlagsMutuallyExclusive("push", "discard")
+}
+
+func runSync(cmd *cobra.Command, args []string) error {
+	if syncFlags.force && !syncFlags.push {
+		return errors.New("--force only applies with --push")
+	}
+	if globalFlags.offline {
+		return fmt.Errorf("sync needs the API: %w", cache.ErrOffline)
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	// 1. Load config, tokens and storage backend
+	sess, err := newSession(ctx)
+	if err != nil {
+		return err
+	}
+	if sess.cache != nil && sess.cache.Offline() {
+		return fmt.Errorf("sync needs the API: %w", cache.ErrOffline)
+	}
+	outbox, err := sess.outbox(false)
+	if err != nil {
+		return err
+	}
+
+	// 2. Drop queued changes if asked to
+	if syncFlags.discard {
+		return discardQueued(outbox)
+	}
+
+	// 3. Replay queued changes in order
+	var conflicts int
+	if syncFlags.push && outbox != nil {
+		if conflicts, err = pushQueued(ctx, sess, outbox); err != nil {
+			return err
+		}
+	}
+
+	// 4. Refresh the local copy
+	if sess.cache != nil {
+		snapshot, err := sess.cache.Refresh(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to refresh the local copy: %w", err)
+		}
+		fmt.Printf("🔄 Local copy is up to date: %d secret(s)\n", len(snapshot.Eggs))
+	}
+
+	// 5. Remind about anything still queued
+	if !syncFlags.push && outbox != nil {
+		if ops, err := outbox.Pending(); err == nil && len(ops) > 0 {
+			fmt.Printf("📮 %d change(s) queued while offline. Run 'egg sync --push' to apply them.\n", len(ops))
+		}
+	}
+	if conflicts > 0 {
+		return fmt.Errorf("%d queued change(s) conflict with the server: %w", conflicts, api.ErrConflict)
+	}
+	return nil
+}
+
+// pushQueued replays the outbox and prints the outcome of each change. It
+// returns how many changes stay queued.
+func pushQueued(ctx context.Context, sess *session, outbox *cache.Outbox) (int, error) {
+	results, err := outbox.Push(ctx, sess.store, syncFlags.force)
+	if len(results) > 0 {
+		fmt.Printf("📤 Pushing %d queued change(s)...\n", len(results))
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			fmt.Printf("   ✗ %s %s: %v\n", result.Op.Kind, result.Op.SecretID, result.Err)
+			continue
+		}
+		fmt.Printf("   ✓ %s %s\n", result.Op.Kind, result.Op.SecretID)
+	}
+	if err != nil {
+		return failed, fmt.Errorf("stopped pushing queued changes: %w", err)
+	}
+	if failed > 0 {
+		fmt.Println("💡 Review conflicts with 'egg get', then use --push --force to overwrite or --discard to drop them.")
+	}
+	return failed, nil
+}
+
+// discardQueued empties the outbox
+func discardQueued(outbox *cache.Outbox) error {
+	if outbox == nil {
+		fmt.Println("📭 Nothing queued")
+		return nil
+	}
+	ops, err := outbox.Pending()
+	if err != nil {
+		return err
+	}
+	if err := outbox.Replace(nil); err != nil {
+		return err
+	}
+	fmt.Printf("🗑️  Discarded %d queued change(s)\n", len(ops))
+	return nil
+}
+
+// outbox opens the profile's outbox. Without create it returns nil when
+// nothing was ever queued; with create the key is made on first use and
+// saved with the tokens.
+func (s *session) outbox(create bool) (*cache.Outbox, error) {
+	if len(s.tokens.OutboxKey) != cache.KeySize {
+		if !create {
+			return nil, nil
+		}
+		key, err := cache.NewKey()
+		if err != nil {
+			return nil, err
+		}
+		s.tokens.OutboxKey = key
+		if err := s.cfg.SaveTokens(s.tokens); err != nil {
+			return nil, fmt.Errorf("failed to save outbox key: %w", err)
+		}
+	}
+
+	path, err := cache.OutboxPath(s.cfg.Profile)
+	if err != nil {
+		return nil, err
+	}
+	return cache.OpenOutbox(path, s.owner, s.tokens.OutboxKey), nil
+}
+
+// queueOffline queues a write that failed because the API is unreachable
+// or the session is offline, and reports whether it did. Other errors are
+// returned as they are. A write is only queued when the local copy can tell
+// which version of the secret it was made against. A put that may have
+// reached the server, e.g. one answered with a 5xx, must come with op.ID
+// set to the Idempotency-Key it was sent with, so pushing it later can't
+// write it twice.
+func queueOffline(sess *session, op cache.Op, err error) (bool, error) {
+	if err == nil || (!errors.Is(err, cache.ErrOffline) && !api.IsUnavailable(err)) {
+		return false, err
+	}
+	if sess.cache == nil {
+		return false, err
+	}
+
+	// 1. Remember what the change was made against, to detect conflicts
+	base, localErr := sess.cache.LocalRevision(op.SecretID)
+	if localErr != nil {
+		return false, fmt.Errorf("%w (and it can't be queued: %w)", err, localErr)
+	}
+	op.Base = base
+	op.QueuedAt = time.Now().UTC()
+
+	// 2. Append it to the outbox
+	outbox, outboxErr := sess.outbox(true)
+	if outboxErr == nil {
+		outboxErr = outbox.Add(op)
+	}
+	if outboxErr != nil {
+		return false, fmt.Errorf("%w (and it can't be queued: %w)", err, outboxErr)
+	}
+
+	// 3. Show it in the local copy, so offline reads see it
+	sess.cache.ApplyQueued(op)
+	return true, nil
+}
+
+// printQueued tells the user a single write was queued
+func printQueued(op cache.Op) {
+	fmt.Printf("📮 Offline: queued %s %s. Run 'egg sync --push' once you're back online.\n", op.Kind, op.SecretID)
+}
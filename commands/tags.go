@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxTagLength bounds tag keys and values, like the API does
+const maxTagLength = 128
+
+// parseTags turns "k=v" flag values into a map. With filter set, a bare
+// "k" is allowed too and matches any value (see api.SecretMetadata.HasTags).
+func parseTags(values []string, filter bool) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	tags := make(map[string]string, len(values))
+	for _, value := range values {
+		k, v, ok := strings.Cut(value, "=")
+		if !ok && !filter {
+			return nil, fmt.Errorf("invalid tag %q: use key=value", value)
+		}
+		if err := validateTagKey(k); err != nil {
+			return nil, err
+		}
+		if len(v) > maxTagLength || strings.ContainsAny(v, ",\n") {
+			return nil, fmt.Errorf("invalid tag %q: values are at most %d characters, without commas or newlines", value, maxTagLength)
+		}
+		if _, dup := tags[k]; dup {
+			return nil, fmt.Errorf("tag %s is given more than once", k)
+		}
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+// validateTagKey checks a tag key: letters, digits and "_.:/-"
+func validateTagKey(k string) error {
+	if k == "" || len(k) > maxTagLength {
+		return fmt.Errorf("invalid tag key %q: must be 1-%d characters", k, maxTagLength)
+	}
+	for _, r := range k {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune("_.:/-", r):
+		default:
+			return fmt.Errorf("invalid tag key %q: contains %q; only letters, digits and '_.:/-' are allowed", k, r)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package commands
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseTimestamp parses the timestamps returned by the API. RFC 3339 is
+// expected, but plain Unix seconds or milliseconds are accepted too.
+func parseTimestamp(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if n > 1e12 {
+			return time.UnixMilli(n), true
+		}
+		return time.Unix(n, 0), true
+	}
+	return time.Time{}, false
+}
+
+// parseDuration extends time.ParseDuration with day ("90d") and week ("2w")
+// units, which is how people talk about secret ages and expiries. Negative
+// durations, and day or week counts too large for a time.Duration, are
+// rejected.
+func parseDuration(value string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if number, ok := strings.CutSuffix(value, suffix); ok {
+			n, err := strconv.ParseFloat(number, 64)
+			if err != nil || math.IsNaN(n) || n*float64(unit) >= math.MaxInt64 {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			if n < 0 {
+				return 0, fmt.Errorf("invalid duration %q: it can't be negative", value)
+			}
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q (use e.g. 36h, 7d or 2w)", value)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid duration %q: it can't be negative", value)
+	}
+	return d, nil
+}
+
+// formatDuration renders a duration the way parseDuration reads it, in
+// days once it is that long, e.g. "14d" or "36h0m0s"
+func formatDuration(d time.Duration) string {
+	day := 24 * time.Hour
+	if d >= day && d%day == 0 {
+		return fmt.Sprintf("%dd", d/day)
+	}
+	return d.String()
+}
+
+// parseSince turns "7d" (relative to now) or "2026-01-01" (a date) into the
+// earliest time a --since filter should accept
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	d, err := parseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --since %q: use a duration like 7d or a date like 2026-01-02", value)
+	}
+	return now.Add(-d), nil
+}
+
+// relativeTime renders t relative to now, e.g. "3 hours ago" or "in 2 days"
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+
+	var amount string
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		amount = plural(int(d/time.Minute), "minute")
+	case d < 24*time.Hour:
+		amount = plural(int(d/time.Hour), "hour")
+	case d < 30*24*time.Hour:
+		amount = plural(int(d/(24*time.Hour)), "day")
+	case d < 365*24*time.Hour:
+		amount = plural(int(d/(30*24*time.Hour)), "month")
+	default:
+		amount = plural(int(d/(365*24*time.Hour)), "year")
+	}
+
+	if future {
+		return "in " + amount
+	}
+	return amount + " ago"
+}
+
+// plural formats a count with a correctly pluralized unit
+func plural(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,131 @@
+package commands
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "7d", want: now.Add(-7 * 24 * time.Hour)},
+		{value: "2w", want: now.Add(-14 * 24 * time.Hour)},
+		{value: "36h", want: now.Add(-36 * time.Hour)},
+		{value: "1.5d", want: now.Add(-36 * time.Hour)},
+		{value: "2026-01-02", want: time.Date(2026, 1, 2, 0, 0, 0, 0, time.Local)},
+		{value: "2026-01-02T15:04:05Z", want: time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{value: "", wantErr: true},
+		{value: "yesterday", wantErr: true},
+		{value: "7x", wantErr: true},
+		{value: "2026-13-01", wantErr: true},
+		{value: "-7d", wantErr: true},
+		{value: "-36h", wantErr: true},
+	} {
+		got, err := parseSince(tt.value, now)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("parseSince(%q) = %v, %v; want %v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for _, tt := range []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "0d", want: 0},
+		{value: "90d", want: 90 * 24 * time.Hour},
+		{value: "2w", want: 14 * 24 * time.Hour},
+		{value: "0.5d", want: 12 * time.Hour},
+		{value: "36h", want: 36 * time.Hour},
+		{value: "-7d", wantErr: true},
+		{value: "-1w", wantErr: true},
+		{value: "-36h", wantErr: true},
+		{value: "NaNd", wantErr: true},
+		{value: "infd", wantErr: true},
+		{value: "-Infw", wantErr: true},
+		{value: "1e300d", wantErr: true},
+		{value: "d", wantErr: true},
+		{value: "", wantErr: true},
+	} {
+		got, err := parseDuration(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, %v; want %v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRelativeTime(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		offset time.Duration
+		want   string
+	}{
+		{0, "just now"},
+		{-59 * time.Second, "just now"},
+		{30 * time.Second, "just now"},
+		{-time.Minute, "1 minute ago"},
+		{-90 * time.Minute, "1 hour ago"},
+		{-3 * time.Hour, "3 hours ago"},
+		{-24 * time.Hour, "1 day ago"},
+		{2 * 24 * time.Hour, "in 2 days"},
+		{-45 * 24 * time.Hour, "1 month ago"},
+		{90 * 24 * time.Hour, "in 3 months"},
+		{-400 * 24 * time.Hour, "1 year ago"},
+		{-800 * 24 * time.Hour, "2 years ago"},
+	} {
+		if got := relativeTime(now.Add(tt.offset), now); got != tt.want {
+			t.Errorf("relativeTime(now%+v) = %q, want %q", tt.offset, got, tt.want)
+		}
+	}
+}
+
+func TestMetadataOrder(t *testing.T) {
+	eggs := []api.EggMetadata{
+		{SecretID: "B", Size: 30, CreatedAt: "2026-01-02T00:00:00Z", UpdatedAt: "2026-03-01T00:00:00Z"},
+		{SecretID: "A", Size: 10, CreatedAt: "2026-01-03T00:00:00Z"},
+		{SecretID: "C", Size: 20, CreatedAt: "2026-01-01T00:00:00Z", UpdatedAt: "2026-02-01T00:00:00Z"},
+	}
+	for _, tt := range []struct {
+		field string
+		want  []string
+	}{
+		{"name", []string{"A", "B", "C"}},
+		{"created", []string{"C", "B", "A"}},
+		{"updated", []string{"A", "C", "B"}}, // A was never updated, so its creation counts
+		{"size", []string{"A", "C", "B"}},
+	} {
+		less, err := metadataOrder(tt.field)
+		if err != nil {
+			t.Fatalf("metadataOrder(%q): %v", tt.field, err)
+		}
+		sorted := slices.Clone(eggs)
+		slices.SortStableFunc(sorted, func(a, b api.EggMetadata) int {
+			switch {
+			case less(a, b):
+				return -1
+			case less(b, a):
+				return 1
+			}
+			return 0
+		})
+		var got []string
+		for _, egg := range sorted {
+			got = append(got, egg.SecretID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("--sort %s = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+	if _, err := metadataOrder("owner"); err == nil {
+		t.Error("metadataOrder accepted an unknown field")
+	}
+}
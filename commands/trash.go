@@ -0,0 +1,110 @@
+package commands
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+	"github.com/owenHochwald/egg-carton/cli/cache"
+	"github.com/spf13/cobra"
+)
+
+// TrashCmd groups the commands that manage deleted secrets
+var TrashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "Manage deleted secrets",
+	Long: `'egg break' moves secrets to the trash, where they stay restorable with
+'egg restore' for the API's retention window and are then deleted for
+good. 'egg break --purge' deletes one from the trash right away.`,
+}
+
+// trashListCmd represents the trash list command
+var trashListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List deleted secrets that can still be restored",
+	Args:    cobra.NoArgs,
+	RunE:    runTrashList,
+}
+
+func init() {
+	TrashCmd.AddCommand(trashListCmd)
+}
+
+func runTrashList(cmd *cobra.Command, args []string) error {
+	now := time.Now()
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	// 1. Load config, tokens and storage backend
+	sess, err := newSession(ctx)
+	if err != nil {
+		return err
+	}
+	trash, ok := trashStore(sess)
+	if !ok {
+		return fmt.Errorf("the %q backend has no trash: %w", cmp.Or(sess.cfg.Backend, api.DefaultBackend), errors.ErrUnsupported)
+	}
+
+	// 2. Stream the trash into a table
+	count := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for egg, err := range trash.AllTrash(ctx, sess.owner) {
+		if err != nil {
+			return fmt.Errorf("failed to list trash: %w", err)
+		}
+		if count == 0 {
+			fmt.Print("🗑️  Trash:\n\n")
+			fmt.Fprintln(w, "KEY\tVERSION\tSIZE\tDELETED\tPURGED")
+		}
+		count++
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			egg.SecretID,
+			formatVersion(egg.Version),
+			formatSize(egg.Size),
+			formatTimestamp(egg.DeletedAt, now),
+			formatTimestamp(egg.PurgeAt, now),
+		)
+	}
+
+	if count == 0 {
+		fmt.Println("The trash is empty.")
+		return nil
+	}
+	return w.Flush()
+}
+
+// trashStore returns the session's store and whether its backend has a
+// trash API (see api.TrashStore). The cache always implements the
+// interface, so the backend behind it decides. Whether deletes actually go
+// to the trash is up to the server; see keepsTrash.
+func trashStore(sess *session) (api.TrashStore, bool) {
+	backend := sess.store
+	if sess.cache != nil {
+		backend = sess.cache.Unwrap()
+	}
+	if _, ok := backend.(api.TrashStore); !ok {
+		return nil, false
+	}
+	trash, ok := sess.store.(api.TrashStore)
+	return trash, ok
+}
+
+// keepsTrash asks the server whether deleted secrets go to its trash, which
+// is only trusted if it reports a retention window. reachable is false when
+// the server couldn't be asked because it is unavailable or the session is
+// offline.
+func keepsTrash(ctx context.Context, sess *session, trash api.TrashStore) (soft, reachable bool) {
+	retention, err := trash.TrashRetention(ctx, sess.owner)
+	if errors.Is(err, cache.ErrOffline) || api.IsUnavailable(err) {
+		return false, false
+	}
+	return err == nil && retention > 0, true
+}
@@ -3,20 +3,36 @@ package config
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
-// Config holds the CLI configuration
+// Config holds the CLI configuration for one profile
 type Config struct {
 	APIEndpoint   string        `json:"api_endpoint"`
 	CognitoConfig CognitoConfig `json:"cognito"`
-	TokenPath     string        `json:"-"` // Not serialized
+
+	// Backend selects the secret storage implementation ("http" if empty)
+	Backend         string            `json:"backend,omitempty"`
+	BackendSettings map[string]string `json:"backend_settings,omitempty"`
+
+	Network  NetworkConfig  `json:"network,omitzero"`
+	Cache    CacheConfig    `json:"cache,omitzero"`
+	Expiry   ExpiryConfig   `json:"expiry,omitzero"`
+	Rotation RotationConfig `json:"rotation,omitzero"`
+
+	Profile    string `json:"-"` // Not serialized
+	TokenPath  string `json:"-"` // Not serialized
+	ConfigPath string `json:"-"` // Not serialized
 }
 
 // CognitoConfig holds Cognito-specific configuration
@@ -27,54 +43,217 @@ type CognitoConfig struct {
 	Region     string `json:"region"`
 }
 
+// NetworkConfig holds proxy and TLS settings for corporate networks. File
+// paths may start with "~/".
+type NetworkConfig struct {
+	Proxy      string   `json:"proxy,omitempty"`       // Proxy URL, or "direct"; default follows HTTPS_PROXY
+	CABundles  []string `json:"ca_bundles,omitempty"`  // Extra trusted CA certificates (PEM)
+	ClientCert string   `json:"client_cert,omitempty"` // Client certificate for mutual TLS (PEM)
+	ClientKey  string   `json:"client_key,omitempty"`  // Private key for client_cert (PEM)
+}
+
+// CacheConfig controls the encrypted local copy of the vault
+type CacheConfig struct {
+	TTL string `json:"ttl,omitempty"` // How long a copy is used without asking the API, e.g. "5m"; "0" disables the cache
+
+	// MaxStaleness is the oldest copy served when the API is unreachable,
+	// e.g. "7d" (the default); "0" means no limit
+	MaxStaleness string `json:"max_staleness,omitempty"`
+}
+
+// ExpiryConfig controls how secret expiry dates are enforced
+type ExpiryConfig struct {
+	WarnWithin string `json:"warn_within,omitempty"` // How long before expiry to start warning, e.g. "14d" (the default)
+	OnExpired  string `json:"on_expired,omitempty"`  // What hatch does with expired secrets: "warn" (the default) or "refuse"
+}
+
+// RotationConfig controls 'egg rotate' and rotation reminders
+type RotationConfig struct {
+	// Interval is how often secrets should be rotated, e.g. "90d"; secrets
+	// not rotated for longer are listed by 'egg expiring'. Empty disables
+	// the reminders.
+	Interval string `json:"interval,omitempty"`
+
+	// Rotators maps secret keys to the command that applies a new value
+	// to the system using it. Paths may start with "~/".
+	Rotators map[string]string `json:"rotators,omitempty"`
+}
+
 // TokenData holds the OAuth tokens
 type TokenData struct {
-	AccessToken  string `json:"access_token"`
-	IDToken      string `json:"id_token"`
-	RefreshToken string `json:"refresh_token"`
-	ExpiresIn    int    `json:"expires_in"`
-	TokenType    string `json:"token_type"`
-	IssuedAt     int64  `json:"issued_at"` // Unix timestamp when token was received
+	SchemaVersion int    `json:"schema_version"`
+	AccessToken   string `json:"access_token"`
+	IDToken       string `json:"id_token"`
+	RefreshToken  string `json:"refresh_token"`
+	ExpiresIn     int    `json:"expires_in"`
+	TokenType     string `json:"token_type"`
+	IssuedAt      int64  `json:"issued_at"` // Unix timestamp when token was received
+
+	// CacheKey encrypts the local vault cache. It lives and dies with the
+	// session, so logging in again makes any old cache unreadable.
+	CacheKey []byte `json:"cache_key,omitempty"`
+
+	// OutboxKey encrypts writes queued while offline. Unlike CacheKey it is
+	// kept when logging in again, so queued writes are never lost.
+	OutboxKey []byte `json:"outbox_key,omitempty"`
 }
 
-// For now, you can hardcode the values from terraform output
+// LoadConfig loads the selected profile (see LoadProfile)
 func LoadConfig() (*Config, error) {
-	err := godotenv.Load()
+	return LoadProfile("")
+}
+
+// LoadProfile reads the named profile from config.json and lets environment
+// variables (or a local .env file) override its values. An empty name picks
+// the profile as described in File.ResolveProfileName.
+func LoadProfile(name string) (*Config, error) {
+	config, err := LoadProfileUnchecked(name)
 	if err != nil {
+		return nil, err
+	}
+
+	if missing := config.MissingFields(); len(missing) > 0 {
+		return nil, fmt.Errorf("profile %q is missing %s: set them in %s, via environment variables, or with 'egg config import-terraform'",
+			config.Profile, strings.Join(missing, ", "), config.ConfigPath)
+	}
+
+	return config, nil
+}
+
+// describeProfiles lists the profiles in file for error messages
+func describeProfiles(file *File) string {
+	if len(file.Profiles) == 0 {
+		return "none"
+	}
+	return strings.Join(slices.Sorted(maps.Keys(file.Profiles)), ", ")
+}
+
+// LoadProfileUnchecked is LoadProfile without the completeness check, for
+// callers such as 'egg config' that need to inspect a partial profile
+func LoadProfileUnchecked(name string) (*Config, error) {
+	migrateLegacyHome()
+
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
 		fmt.Println("An error occured while loading .env file")
 	}
-	APIEndpoint := os.Getenv("API_ENDPOINT")
-	UserPoolID := os.Getenv("COGNITO_USER_POOL_ID")
-	ClientID := os.Getenv("COGNITO_CLIENT_ID")
-	Domain := os.Getenv("COGNITO_DOMAIN")
-	Region := os.Getenv("COGNITO_REGION")
 
-	if APIEndpoint == "" || UserPoolID == "" || ClientID == "" || Domain == "" || Region == "" {
-		return nil, fmt.Errorf("missing required environment variables")
+	file, err := ReadConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	selected := name != "" || os.Getenv(ProfileEnv) != ""
+	name, err = file.ResolveProfileName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// A profile picked with --profile or $EGG_PROFILE must exist, so a typo
+	// doesn't silently run against whatever the environment sets. The
+	// default profile may live in the environment alone.
+	config := &Config{}
+	profile, ok := file.Profiles[name]
+	switch {
+	case ok:
+		*config = *profile
+	case selected && name != DefaultProfile:
+		return nil, fmt.Errorf("unknown profile %q (configured: %s): check the name, or create it with 'egg --profile %s config import-terraform'", name, describeProfiles(file), name)
 	}
-	// TODO: Get these from environment variables or config file
-	// For now, hardcode from your terraform output:
-	config := &Config{
-		APIEndpoint: APIEndpoint,
-		CognitoConfig: CognitoConfig{
-			UserPoolID: UserPoolID,
-			ClientID:   ClientID,
-			Domain:     Domain,
-			Region:     Region,
-		},
+	config.Profile = name
+	if config.ConfigPath, err = ConfigFilePath(); err != nil {
+		return nil, err
 	}
 
+	overrideFromEnv(&config.APIEndpoint, "API_ENDPOINT")
+	overrideFromEnv(&config.CognitoConfig.UserPoolID, "COGNITO_USER_POOL_ID")
+	overrideFromEnv(&config.CognitoConfig.ClientID, "COGNITO_CLIENT_ID")
+	overrideFromEnv(&config.CognitoConfig.Domain, "COGNITO_DOMAIN")
+	overrideFromEnv(&config.CognitoConfig.Region, "COGNITO_REGION")
+	overrideFromEnv(&config.Cache.TTL, "EGG_CACHE_TTL")
+	overrideFromEnv(&config.Cache.MaxStaleness, "EGG_MAX_STALENESS")
+	overrideFromEnv(&config.Expiry.WarnWithin, "EGG_EXPIRY_WARN_WITHIN")
+	overrideFromEnv(&config.Expiry.OnExpired, "EGG_ON_EXPIRED")
+	overrideFromEnv(&config.Rotation.Interval, "EGG_ROTATION_INTERVAL")
+	overrideFromEnv(&config.Network.Proxy, "EGG_PROXY")
+	overrideFromEnv(&config.Network.ClientCert, "EGG_CLIENT_CERT")
+	overrideFromEnv(&config.Network.ClientKey, "EGG_CLIENT_KEY")
+	if bundles := os.Getenv("EGG_CA_BUNDLE"); bundles != "" {
+		config.Network.CABundles = filepath.SplitList(bundles)
+	}
+	config.Network.expandHome()
+	config.Rotation.expandHome()
+
 	// Set token path
-	home, err := os.UserHomeDir()
+	stateDir, err := StateDir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
+		return nil, err
 	}
-	config.TokenPath = filepath.Join(home, ".eggcarton", "credentials.json")
+	config.TokenPath = filepath.Join(stateDir, tokenFileName(name))
 
 	return config, nil
 }
 
-// Should save tokens to ~/.eggcarton/credentials.json with 0600 permissions
+// MissingFields lists the JSON names of required settings that are empty
+func (c *Config) MissingFields() []string {
+	var missing []string
+	for _, field := range []struct {
+		name  string
+		value string
+	}{
+		{"api_endpoint", c.APIEndpoint},
+		{"cognito.user_pool_id", c.CognitoConfig.UserPoolID},
+		{"cognito.client_id", c.CognitoConfig.ClientID},
+		{"cognito.domain", c.CognitoConfig.Domain},
+		{"cognito.region", c.CognitoConfig.Region},
+	} {
+		if field.value == "" {
+			missing = append(missing, field.name)
+		}
+	}
+	return missing
+}
+
+// expandHome resolves a leading "~/" in the network file paths
+func (n *NetworkConfig) expandHome() {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+
+	n.ClientCert = expandHomePath(home, n.ClientCert)
+	n.ClientKey = expandHomePath(home, n.ClientKey)
+	for i, path := range n.CABundles {
+		n.CABundles[i] = expandHomePath(home, path)
+	}
+}
+
+// expandHome resolves a leading "~/" in the rotator commands
+func (r *RotationConfig) expandHome() {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+	for key, command := range r.Rotators {
+		r.Rotators[key] = expandHomePath(home, command)
+	}
+}
+
+// expandHomePath replaces a leading "~/" with home
+func expandHomePath(home, path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		return filepath.Join(home, rest)
+	}
+	return path
+}
+
+// overrideFromEnv replaces *field with the environment variable when it is set
+func overrideFromEnv(field *string, key string) {
+	if value := os.Getenv(key); value != "" {
+		*field = value
+	}
+}
+
+// Should save tokens to the state directory with 0600 permissions
 func (c *Config) SaveTokens(tokens *TokenData) error {
 	// Create directory if it doesn't exist
 	dir := filepath.Dir(c.TokenPath)
@@ -83,22 +262,23 @@ func (c *Config) SaveTokens(tokens *TokenData) error {
 	}
 
 	// Marshal tokens to JSON
+	tokens.SchemaVersion = credentialsSchema.Version
 	b, err := json.MarshalIndent(tokens, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal tokens: %w", err)
 	}
 
 	// Write to file with secure permissions
-	if err := os.WriteFile(c.TokenPath, b, 0600); err != nil {
+	if err := WriteFileAtomic(c.TokenPath, b, 0600); err != nil {
 		return fmt.Errorf("failed to write tokens to file: %w", err)
 	}
 
 	return nil
 }
 
-// Should load tokens from ~/.eggcarton/credentials.json
+// Should load tokens from the state directory
 func (c *Config) LoadTokens() (*TokenData, error) {
-	data, err := os.ReadFile(c.TokenPath)
+	data, err := credentialsSchema.Read(c.TokenPath)
 	if err != nil {
 		return nil, err
 	}
@@ -128,13 +308,23 @@ func (c *Config) GetRedirectURI() string {
 
 // Returns the full authorization URL for Cognito
 func (c *Config) GetAuthorizationURL() string {
-
-	return fmt.Sprintf("https://%s/oauth2/authorize", c.CognitoConfig.Domain)
+	return c.cognitoBaseURL() + "/oauth2/authorize"
 }
 
 // Returns the token exchange endpoint
 func (c *Config) GetTokenURL() string {
-	return fmt.Sprintf("https://%s/oauth2/token", c.CognitoConfig.Domain)
+	return c.cognitoBaseURL() + "/oauth2/token"
+}
+
+// cognitoBaseURL returns the hosted UI base URL. The domain is normally a
+// bare host name, but may carry its own scheme (e.g. http://127.0.0.1:9000)
+// to point the CLI at a local fake such as the eggtest package.
+func (c *Config) cognitoBaseURL() string {
+	domain := strings.TrimSuffix(c.CognitoConfig.Domain, "/")
+	if strings.Contains(domain, "://") {
+		return domain
+	}
+	return "https://" + domain
 }
 
 // Returns the API base URL
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// appName is the directory name used under each XDG base directory
+const appName = "eggcarton"
+
+// EggHomeEnv overrides every base directory when set. Everything the CLI
+// reads or writes then lives under that single directory, which keeps tests
+// and throwaway environments away from the real user's files.
+const EggHomeEnv = "EGG_HOME"
+
+// ConfigDir returns the directory holding config.json
+// ($EGG_HOME, else $XDG_CONFIG_HOME/eggcarton, else ~/.config/eggcarton)
+func ConfigDir() (string, error) {
+	return baseDir("XDG_CONFIG_HOME", ".config", "")
+}
+
+// StateDir returns the directory holding credentials and other session state
+// ($EGG_HOME, else $XDG_STATE_HOME/eggcarton, else ~/.local/state/eggcarton)
+func StateDir() (string, error) {
+	return baseDir("XDG_STATE_HOME", filepath.Join(".local", "state"), "")
+}
+
+// CacheDir returns the directory holding disposable caches
+// ($EGG_HOME/cache, else $XDG_CACHE_HOME/eggcarton, else ~/.cache/eggcarton)
+func CacheDir() (string, error) {
+	return baseDir("XDG_CACHE_HOME", ".cache", "cache")
+}
+
+// baseDir resolves one XDG base directory. Relative XDG values are ignored,
+// as the spec requires.
+func baseDir(xdgEnv, homeFallback, eggHomeSub string) (string, error) {
+	if eggHome := os.Getenv(EggHomeEnv); eggHome != "" {
+		return filepath.Join(eggHome, eggHomeSub), nil
+	}
+
+	if xdg := os.Getenv(xdgEnv); xdg != "" && filepath.IsAbs(xdg) {
+		return filepath.Join(xdg, appName), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, homeFallback, appName), nil
+}
+
+// legacyDir returns the pre-XDG ~/.eggcarton directory
+func legacyDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".eggcarton"), nil
+}
+
+var migrateOnce sync.Once
+
+// migrateLegacyHome moves files from ~/.eggcarton into the XDG directories.
+// It runs at most once per process and never when EGG_HOME is set, so tests
+// cannot touch a real home directory. Files already present at the new
+// location win; the legacy copy is then left in place untouched.
+func migrateLegacyHome() {
+	migrateOnce.Do(func() {
+		if os.Getenv(EggHomeEnv) != "" {
+			return
+		}
+
+		legacy, err := legacyDir()
+		if err != nil {
+			return
+		}
+		if _, err := os.Stat(legacy); err != nil {
+			return
+		}
+
+		stateDir, err := StateDir()
+		if err != nil {
+			return
+		}
+
+		// Only credentials.json was ever written to the legacy directory
+		from := filepath.Join(legacy, "credentials.json")
+		to := filepath.Join(stateDir, "credentials.json")
+		if _, err := os.Stat(from); err != nil {
+			return
+		}
+		if _, err := os.Stat(to); err == nil {
+			return
+		}
+
+		if err := os.MkdirAll(stateDir, 0700); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Could not migrate %s: %v\n", legacy, err)
+			return
+		}
+		if err := moveFile(from, to); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Could not migrate %s: %v\n", legacy, err)
+			return
+		}
+
+		// Remove the old directory only if nothing else lives in it
+		_ = os.Remove(legacy)
+
+		fmt.Fprintf(os.Stderr, "📦 Moved credentials from %s to %s\n", legacy, stateDir)
+	})
+}
+
+// moveFile renames a file, falling back to copy+delete across filesystems
+func moveFile(from, to string) error {
+	if err := os.Rename(from, to); err == nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(to, data, 0600); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
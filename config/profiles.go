@@ -0,0 +1,129 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// DefaultProfile is used when no profile is selected
+const DefaultProfile = "default"
+
+// ProfileEnv selects a profile when --profile is not given
+const ProfileEnv = "EGG_PROFILE"
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// File is the on-disk layout of config.json
+type File struct {
+	SchemaVersion  int                `json:"schema_version"`
+	CurrentProfile string             `json:"current_profile,omitempty"`
+	Profiles       map[string]*Config `json:"profiles"`
+}
+
+// ConfigFilePath returns the location of config.json
+func ConfigFilePath() (string, error) {
+	configDir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "config.json"), nil
+}
+
+// ReadConfigFile loads config.json, returning an empty File if none exists yet
+func ReadConfigFile() (*File, error) {
+	path, err := ConfigFilePath()
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{Profiles: map[string]*Config{}}
+	data, err := configSchema.Read(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return file, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if err := json.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if file.Profiles == nil {
+		file.Profiles = map[string]*Config{}
+	}
+
+	return file, nil
+}
+
+// Save writes config.json with 0600 permissions
+func (f *File) Save() error {
+	path, err := ConfigFilePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	f.SchemaVersion = configSchema.Version
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	if err := WriteFileAtomic(path, b, 0600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	return nil
+}
+
+// ResolveProfileName picks the profile to use: the explicit name if given,
+// then $EGG_PROFILE, then current_profile from config.json, then "default"
+func (f *File) ResolveProfileName(name string) (string, error) {
+	if name == "" {
+		name = os.Getenv(ProfileEnv)
+	}
+	if name == "" {
+		name = f.CurrentProfile
+	}
+	if name == "" {
+		name = DefaultProfile
+	}
+
+	if !profileNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid profile name %q: use letters, digits, '-' and '_'", name)
+	}
+
+	return name, nil
+}
+
+// tokenFileName returns the credentials file name for a profile. The default
+// profile keeps the historical credentials.json name.
+func tokenFileName(profile string) string {
+	if profile == DefaultProfile {
+		return "credentials.json"
+	}
+	return fmt.Sprintf("credentials-%s.json", profile)
+}
+
+// migrateConfigV1 moves the single flat v1 config into the "default" profile
+func migrateConfigV1(doc map[string]any) error {
+	profile := map[string]any{}
+	for _, key := range []string{"api_endpoint", "cognito"} {
+		if value, ok := doc[key]; ok {
+			profile[key] = value
+			delete(doc, key)
+		}
+	}
+
+	doc["current_profile"] = DefaultProfile
+	doc["profiles"] = map[string]any{DefaultProfile: profile}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrNewerSchema is returned when a file was written by a newer CLI release
+var ErrNewerSchema = errors.New("file was written by a newer version of egg")
+
+// MigrationFunc upgrades a decoded file by exactly one schema version
+type MigrationFunc func(doc map[string]any) error
+
+// Schema describes one versioned on-disk file format.
+//
+// Every file the CLI writes carries a top-level "schema_version". Files from
+// before versioning existed have no such field and are treated as version 0.
+type Schema struct {
+	Name       string                // Shown in messages, e.g. "credentials"
+	Version    int                   // Version written by this build
+	Migrations map[int]MigrationFunc // Keyed by the version they upgrade from
+}
+
+// credentialsSchema describes credentials.json (TokenData)
+var credentialsSchema = &Schema{
+	Name:    "credentials",
+	Version: 1,
+	Migrations: map[int]MigrationFunc{
+		// v0 files predate schema_version; the layout is otherwise unchanged
+		0: func(doc map[string]any) error { return nil },
+	},
+}
+
+// configSchema describes config.json (File)
+var configSchema = &Schema{
+	Name:    "config",
+	Version: 2,
+	Migrations: map[int]MigrationFunc{
+		0: func(doc map[string]any) error { return nil },
+		1: migrateConfigV1,
+	},
+}
+
+// Read loads the file at path and upgrades it to the current version.
+// Upgraded files are backed up to <path>.v<N>.bak and rewritten in place
+// before the new contents are returned. Files from a newer release are
+// rejected with ErrNewerSchema rather than risk losing their data.
+func (s *Schema) Read(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	version := 0
+	if raw, ok := doc["schema_version"]; ok {
+		v, ok := raw.(float64)
+		if !ok || v < 0 || v != float64(int(v)) {
+			return nil, fmt.Errorf("invalid schema_version in %s", path)
+		}
+		version = int(v)
+	}
+
+	if version > s.Version {
+		return nil, fmt.Errorf("%w: %s is schema v%d but this build supports up to v%d, please upgrade egg",
+			ErrNewerSchema, path, version, s.Version)
+	}
+	if version == s.Version {
+		return data, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	backup := fmt.Sprintf("%s.v%d.bak", path, version)
+	if err := WriteFileAtomic(backup, data, info.Mode().Perm()); err != nil {
+		return nil, fmt.Errorf("failed to back up %s before migrating: %w", path, err)
+	}
+
+	for v := version; v < s.Version; v++ {
+		migrate, ok := s.Migrations[v]
+		if !ok {
+			return nil, fmt.Errorf("no migration for %s schema v%d", s.Name, v)
+		}
+		if err := migrate(doc); err != nil {
+			return nil, fmt.Errorf("failed to migrate %s from v%d to v%d: %w", s.Name, v, v+1, err)
+		}
+		doc["schema_version"] = v + 1
+	}
+
+	migrated, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal migrated %s: %w", s.Name, err)
+	}
+	if err := WriteFileAtomic(path, migrated, info.Mode().Perm()); err != nil {
+		return nil, fmt.Errorf("failed to write migrated %s: %w", s.Name, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "📦 Upgraded %s from schema v%d to v%d (backup: %s)\n", s.Name, version, s.Version, backup)
+
+	return migrated, nil
+}
+
+// WriteFileAtomic writes data to a temp file in the same directory and
+// renames it over path, so readers never see a half-written file
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,298 @@
+package eggtest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/owenHochwald/egg-carton/cli/config"
+)
+
+// authCode is an issued authorization code waiting to be exchanged
+type authCode struct {
+	sub           string
+	redirectURI   string
+	codeChallenge string
+	expiresAt     time.Time
+}
+
+// IssueTokens mints a fresh token set for sub without going through the
+// browser flow, for tests that only need to be logged in
+func (s *Server) IssueTokens(sub string) *config.TokenData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens, err := s.issueTokens(sub, true)
+	if err != nil {
+		panic(fmt.Sprintf("eggtest: failed to sign tokens: %v", err))
+	}
+	return &config.TokenData{
+		AccessToken:  tokens.AccessToken,
+		IDToken:      tokens.IDToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		TokenType:    tokens.TokenType,
+		IssuedAt:     time.Now().Unix(),
+	}
+}
+
+// handleAuthorize stands in for the Cognito hosted UI. The user is logged in
+// immediately and redirected back with a code, so a test can follow the
+// redirect instead of driving a browser.
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI := query.Get("redirect_uri")
+	redirect, err := url.Parse(redirectURI)
+	if redirectURI == "" || err != nil || !redirect.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	// Protocol errors are reported to the client through the redirect
+	fail := func(code string) {
+		q := redirect.Query()
+		q.Set("error", code)
+		if state := query.Get("state"); state != "" {
+			q.Set("state", state)
+		}
+		redirect.RawQuery = q.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	}
+
+	switch {
+	case query.Get("client_id") != s.clientID:
+		fail("unauthorized_client")
+		return
+	case query.Get("response_type") != "code":
+		fail("unsupported_response_type")
+		return
+	case query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256":
+		fail("invalid_request")
+		return
+	}
+
+	code := randomToken()
+	s.mu.Lock()
+	s.codes[code] = authCode{
+		sub:           s.user,
+		redirectURI:   redirectURI,
+		codeChallenge: query.Get("code_challenge"),
+		expiresAt:     time.Now().Add(5 * time.Minute),
+	}
+	s.mu.Unlock()
+
+	q := redirect.Query()
+	q.Set("code", code)
+	if state := query.Get("state"); state != "" {
+		q.Set("state", state)
+	}
+	redirect.RawQuery = q.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// tokenResponse is what Cognito's /oauth2/token returns
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in"`
+	TokenType    string `json:"token_type"`
+}
+
+// handleToken implements the authorization_code (with PKCE) and
+// refresh_token grants the way Cognito does, including its error bodies
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, "invalid_request")
+		return
+	}
+	if r.PostForm.Get("client_id") != s.clientID {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		// Codes are single use, even when the exchange fails
+		code, ok := s.codes[r.PostForm.Get("code")]
+		delete(s.codes, r.PostForm.Get("code"))
+		if !ok || time.Now().After(code.expiresAt) || code.redirectURI != r.PostForm.Get("redirect_uri") {
+			writeOAuthError(w, "invalid_grant")
+			return
+		}
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != code.codeChallenge {
+			writeOAuthError(w, "invalid_grant")
+			return
+		}
+
+		tokens, err := s.issueTokens(code.sub, true)
+		if err != nil {
+			writeOAuthError(w, "server_error")
+			return
+		}
+		writeJSON(w, http.StatusOK, tokens)
+
+	case "refresh_token":
+		sub, ok := s.refreshTokens[r.PostForm.Get("refresh_token")]
+		if !ok {
+			writeOAuthError(w, "invalid_grant")
+			return
+		}
+		// Like Cognito, the refresh token itself is not rotated
+		tokens, err := s.issueTokens(sub, false)
+		if err != nil {
+			writeOAuthError(w, "server_error")
+			return
+		}
+		writeJSON(w, http.StatusOK, tokens)
+
+	default:
+		writeOAuthError(w, "unsupported_grant_type")
+	}
+}
+
+// handleJWKS publishes the public half of the signing key
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	pub := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": s.keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// issueTokens signs an access and ID token for sub; the caller holds s.mu
+func (s *Server) issueTokens(sub string, withRefresh bool) (*tokenResponse, error) {
+	now := time.Now()
+	claims := map[string]any{
+		"sub":       sub,
+		"iss":       s.URL,
+		"client_id": s.clientID,
+		"username":  sub,
+		"iat":       now.Unix(),
+		"exp":       now.Add(s.tokenTTL).Unix(),
+	}
+
+	claims["token_use"] = "access"
+	claims["scope"] = "openid email profile"
+	access, err := s.sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(claims, "scope")
+	claims["token_use"] = "id"
+	claims["aud"] = s.clientID
+	claims["email"] = sub + "@eggtest.local"
+	id, err := s.sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := &tokenResponse{
+		AccessToken: access,
+		IDToken:     id,
+		ExpiresIn:   int(s.tokenTTL / time.Second),
+		TokenType:   "Bearer",
+	}
+	if withRefresh {
+		tokens.RefreshToken = randomToken()
+		s.refreshTokens[tokens.RefreshToken] = sub
+	}
+	return tokens, nil
+}
+
+// sign encodes claims as an RS256 JWT
+func (s *Server) sign(claims map[string]any) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": s.keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// verifyBearer checks an "Authorization: Bearer" header the way the API
+// Gateway authorizer does and returns the token's subject
+func (s *Server) verifyBearer(header string) (string, error) {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return "", errors.New("missing bearer token")
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("malformed token")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.New("malformed token signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&s.key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		return "", errors.New("invalid token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.New("malformed token payload")
+	}
+	var claims struct {
+		Sub      string `json:"sub"`
+		TokenUse string `json:"token_use"`
+		Exp      int64  `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", errors.New("malformed token claims")
+	}
+	switch {
+	case claims.TokenUse != "access":
+		return "", errors.New("not an access token")
+	case time.Now().Unix() >= claims.Exp:
+		return "", errors.New("token expired")
+	case claims.Sub == "":
+		return "", errors.New("token has no subject")
+	}
+	return claims.Sub, nil
+}
+
+// writeOAuthError writes an OAuth error body as Cognito does
+func writeOAuthError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+// randomToken returns an unguessable opaque token
+func randomToken() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
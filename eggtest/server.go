@@ -0,0 +1,721 @@
+// Package eggtest provides an in-process fake of an EggCarton deployment for
+// tests: the secrets API, a Cognito-like OAuth server that issues signed
+// JWTs, and a JWKS endpoint, all behind one httptest.Server.
+//
+//	srv := eggtest.NewServer(t)
+//	cfg := srv.Config() // points the API and Cognito at the fake
+//	tokens := srv.IssueTokens("user-1")
+//	client := api.NewClient(cfg.APIEndpoint, tokens.AccessToken)
+//
+// Faults can be injected to exercise retries and timeouts:
+//
+//	srv.FailNext(2, http.StatusServiceUnavailable)
+//	srv.SetLatency(50 * time.Millisecond)
+package eggtest
+
+import (
+	"cmp"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+	"github.com/owenHochwald/egg-carton/cli/config"
+)
+
+// Defaults used unless overridden with an Option
+const (
+	DefaultClientID = "eggtest-client"
+	DefaultUser     = "eggtest-user"
+	DefaultPageSize = 50
+
+	// DefaultTrashRetention is how long deleted secrets stay restorable
+	DefaultTrashRetention = 30 * 24 * time.Hour
+)
+
+// Server is a fake EggCarton deployment. It is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	clientID string
+	user     string
+	pageSize int
+	tokenTTL time.Duration
+	trashTTL time.Duration
+	key      *rsa.PrivateKey
+	keyID    string
+
+	mu            sync.Mutex
+	eggs          map[string]map[string]*egg // owner -> secret ID -> egg
+	trash         map[string]map[string]*egg // owner -> secret ID -> deleted egg
+	versions      map[string]int             // owner -> vault version, for ETags
+	requests      int                        // API requests served
+	codes         map[string]authCode        // one-time authorization codes
+	refreshTokens map[string]string          // refresh token -> subject
+	idempotency   map[string]bool            // Idempotency-Key values already applied
+	latency       time.Duration
+	faults        []int // status codes to answer the next API requests with
+	losses        []int // status codes to answer the next API requests with after handling them
+}
+
+// egg is one stored secret
+type egg struct {
+	plaintext string
+	version   int64 // Bumped on every write
+	createdAt time.Time
+	updatedAt time.Time
+	meta      api.SecretMetadata
+	history   []api.EggVersion // Every version written, oldest first
+	deletedAt time.Time        // When it was moved to the trash
+}
+
+// Option customizes a Server
+type Option func(*Server)
+
+// WithClientID sets the OAuth client ID the fake accepts
+func WithClientID(clientID string) Option {
+	return func(s *Server) { s.clientID = clientID }
+}
+
+// WithUser sets the subject that /oauth2/authorize logs in as
+func WithUser(sub string) Option {
+	return func(s *Server) { s.user = sub }
+}
+
+// WithPageSize sets how many secrets each page of a listing holds
+func WithPageSize(n int) Option {
+	return func(s *Server) { s.pageSize = n }
+}
+
+// WithTokenTTL sets the lifetime of issued access and ID tokens
+func WithTokenTTL(ttl time.Duration) Option {
+	return func(s *Server) { s.tokenTTL = ttl }
+}
+
+// WithTrashRetention sets how long deleted secrets stay in the trash. Zero
+// makes every delete permanent, like an API without a trash.
+func WithTrashRetention(d time.Duration) Option {
+	return func(s *Server) { s.trashTTL = d }
+}
+
+// NewServer starts a fake deployment that is shut down when the test ends
+func NewServer(tb testing.TB, opts ...Option) *Server {
+	tb.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		tb.Fatalf("eggtest: failed to generate signing key: %v", err)
+	}
+
+	s := &Server{
+		clientID:      DefaultClientID,
+		user:          DefaultUser,
+		pageSize:      DefaultPageSize,
+		tokenTTL:      time.Hour,
+		trashTTL:      DefaultTrashRetention,
+		key:           key,
+		keyID:         "eggtest-1",
+		eggs:          map[string]map[string]*egg{},
+		trash:         map[string]map[string]*egg{},
+		versions:      map[string]int{},
+		codes:         map[string]authCode{},
+		refreshTokens: map[string]string{},
+		idempotency:   map[string]bool{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/jwks.json", s.handleJWKS)
+	mux.HandleFunc("GET /oauth2/authorize", s.handleAuthorize)
+	mux.HandleFunc("POST /oauth2/token", s.handleToken)
+	mux.HandleFunc("POST /eggs", s.api(s.handlePutEgg))
+	mux.HandleFunc("GET /eggs/{owner}", s.api(s.handleListEggs))
+	mux.HandleFunc("GET /eggs/{owner}/{key}", s.api(s.handleGetEgg))
+	mux.HandleFunc("GET /eggs/{owner}/{key}/versions", s.api(s.handleEggHistory))
+	mux.HandleFunc("POST /eggs/{owner}/{key}/restore", s.api(s.handleRestoreEgg))
+	mux.HandleFunc("PATCH /eggs/{owner}/{key}/metadata", s.api(s.handleUpdateMetadata))
+	mux.HandleFunc("DELETE /eggs/{owner}/{key}", s.api(s.handleBreakEgg))
+
+	s.Server = httptest.NewServer(mux)
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// Config returns a profile that points both the API and Cognito at the fake
+func (s *Server) Config() *config.Config {
+	return &config.Config{
+		APIEndpoint: s.URL,
+		CognitoConfig: config.CognitoConfig{
+			UserPoolID: "local_eggtest",
+			ClientID:   s.clientID,
+			Domain:     s.URL,
+			Region:     "local",
+		},
+	}
+}
+
+// Seed stores a secret directly, bypassing the API. The owner is recorded
+// as the author of the new version.
+func (s *Server) Seed(owner, secretID, plaintext string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(owner, owner, api.PutEggRequest{SecretID: secretID, Plaintext: plaintext})
+}
+
+// Secret returns a stored secret's value, bypassing the API
+func (s *Server) Secret(owner, secretID string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.eggs[owner][secretID]
+	if !ok {
+		return "", false
+	}
+	return e.plaintext, true
+}
+
+// Trashed reports whether a secret is in the trash, bypassing the API
+func (s *Server) Trashed(owner, secretID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireTrash(owner)
+	_, ok := s.trash[owner][secretID]
+	return ok
+}
+
+// Metadata returns a stored secret's metadata, bypassing the API
+func (s *Server) Metadata(owner, secretID string) (api.SecretMetadata, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.eggs[owner][secretID]
+	if !ok {
+		return api.SecretMetadata{}, false
+	}
+	return e.meta, true
+}
+
+// Requests returns how many API requests the server has received
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// SetLatency delays every API response by d
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// FailNext makes the next n API requests fail with status, e.g. 429 or 503.
+// Throttling and unavailable responses carry "Retry-After: 0" so clients
+// retry without slowing the test down.
+func (s *Server) FailNext(n, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for range n {
+		s.faults = append(s.faults, status)
+	}
+}
+
+// LoseNext makes the server handle the next n API requests but answer
+// them with status, as if the response was lost on the way back, e.g. to
+// check that a retried write is not applied twice
+func (s *Server) LoseNext(n, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for range n {
+		s.losses = append(s.losses, status)
+	}
+}
+
+// api wraps a secrets API handler with fault injection and bearer token
+// authentication. The handler receives the token's subject.
+func (s *Server) api(handler func(w http.ResponseWriter, r *http.Request, sub string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// 1. Injected latency and failures
+		s.mu.Lock()
+		s.requests++
+		latency := s.latency
+		fault, lost := 0, 0
+		if len(s.faults) > 0 {
+			fault, s.faults = s.faults[0], s.faults[1:]
+		} else if len(s.losses) > 0 {
+			lost, s.losses = s.losses[0], s.losses[1:]
+		}
+		s.mu.Unlock()
+
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if fault != 0 {
+			if fault == http.StatusTooManyRequests || fault == http.StatusServiceUnavailable {
+				w.Header().Set("Retry-After", "0")
+			}
+			writeError(w, fault, "INJECTED_FAULT", "injected fault")
+			return
+		}
+
+		// 2. Authentication, like the API Gateway Cognito authorizer
+		sub, err := s.verifyBearer(r.Header.Get("Authorization"))
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", err.Error())
+			return
+		}
+
+		// 3. Owners may only touch their own vault
+		if owner := r.PathValue("owner"); owner != "" && owner != sub {
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "cannot access another owner's secrets")
+			return
+		}
+
+		// 4. Lost responses are handled, but the client only sees the failure
+		if lost != 0 {
+			handler(discardWriter{header: http.Header{}}, r, sub)
+			writeError(w, lost, "INJECTED_FAULT", "injected lost response")
+			return
+		}
+		handler(w, r, sub)
+	}
+}
+
+// discardWriter is an http.ResponseWriter that drops the response
+type discardWriter struct {
+	header http.Header
+}
+
+func (d discardWriter) Header() http.Header       { return d.header }
+func (discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (discardWriter) WriteHeader(int)             {}
+
+func (s *Server) handlePutEgg(w http.ResponseWriter, r *http.Request, sub string) {
+	var req api.PutEggRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid JSON body")
+		return
+	}
+	if req.SecretID == "" {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "secret_id is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A replayed Idempotency-Key succeeds without writing again
+	idempotencyKey := r.Header.Get(api.IdempotencyKeyHeader)
+	if idempotencyKey != "" && s.idempotency[idempotencyKey] {
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	// Conditional writes fail with 412 and the current copy
+	if !preconditionMet(r, s.eggs[sub][req.SecretID]) {
+		body := map[string]any{"error": "the secret has changed", "code": "VERSION_MISMATCH"}
+		if e, ok := s.eggs[sub][req.SecretID]; ok {
+			body["current"] = e.metadata(req.SecretID)
+		}
+		writeErrorBody(w, http.StatusPreconditionFailed, body)
+		return
+	}
+
+	if idempotencyKey != "" {
+		s.idempotency[idempotencyKey] = true
+	}
+	s.put(sub, sub, req)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// preconditionMet checks If-Match and If-None-Match against a secret,
+// which is nil if it doesn't exist
+func preconditionMet(r *http.Request, e *egg) bool {
+	if r.Header.Get("If-None-Match") == "*" && e != nil {
+		return false
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		return e != nil && ifMatch == strconv.Quote(strconv.FormatInt(e.version, 10))
+	}
+	return true
+}
+
+func (s *Server) handleGetEgg(w http.ResponseWriter, r *http.Request, sub string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secretID := r.PathValue("key")
+	e, ok := s.eggs[sub][secretID]
+	if !ok {
+		writeError(w, http.StatusNotFound, "EGG_NOT_FOUND", "secret does not exist")
+		return
+	}
+
+	// An earlier version is served from the history
+	if v := r.URL.Query().Get("version"); v != "" {
+		version, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || version < 1 || version > int64(len(e.history)) {
+			writeError(w, http.StatusNotFound, "VERSION_NOT_FOUND", "version does not exist")
+			return
+		}
+		old := e.history[version-1]
+		resp := e.response(sub, secretID)
+		resp.Plaintext, resp.Version, resp.UpdatedAt = old.Plaintext, old.Version, old.WrittenAt
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	w.Header().Set("ETag", strconv.Quote(strconv.FormatInt(e.version, 10)))
+	if r.URL.Query().Get("view") == "metadata" {
+		writeJSON(w, http.StatusOK, e.metadata(secretID))
+		return
+	}
+	writeJSON(w, http.StatusOK, e.response(sub, secretID))
+}
+
+func (s *Server) handleEggHistory(w http.ResponseWriter, r *http.Request, sub string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.eggs[sub][r.PathValue("key")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "EGG_NOT_FOUND", "secret does not exist")
+		return
+	}
+
+	// Pages run newest first; the token is the last version of the previous page
+	before := len(e.history)
+	if token := r.URL.Query().Get(api.PageTokenParam); token != "" {
+		after, err := base64.RawURLEncoding.DecodeString(token)
+		n, convErr := strconv.Atoi(string(after))
+		if err != nil || convErr != nil {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid "+api.PageTokenParam)
+			return
+		}
+		before = min(n-1, len(e.history))
+	}
+	end := max(before-s.pageSize, 0)
+
+	resp := api.EggVersionsResponse{Versions: []api.EggVersion{}}
+	for i := before - 1; i >= end; i-- {
+		version := e.history[i]
+		if r.URL.Query().Get("view") != "full" {
+			version.Plaintext = ""
+		}
+		resp.Versions = append(resp.Versions, version)
+	}
+	if end > 0 {
+		resp.NextToken = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end + 1)))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleUpdateMetadata(w http.ResponseWriter, r *http.Request, sub string) {
+	var patch api.MetadataPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid JSON body")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secretID := r.PathValue("key")
+	e, ok := s.eggs[sub][secretID]
+	if !ok {
+		writeError(w, http.StatusNotFound, "EGG_NOT_FOUND", "secret does not exist")
+		return
+	}
+
+	if patch.Description != nil {
+		e.meta.Description = *patch.Description
+	}
+	if patch.OwnerTeam != nil {
+		e.meta.OwnerTeam = *patch.OwnerTeam
+	}
+	if patch.ExpiresAt != nil {
+		e.meta.ExpiresAt = *patch.ExpiresAt
+	}
+	e.meta.Tags = mergeTags(e.meta.Tags, patch.SetTags)
+	for _, k := range patch.RemoveTags {
+		delete(e.meta.Tags, k)
+	}
+	if len(e.meta.Tags) == 0 {
+		e.meta.Tags = nil
+	}
+	s.versions[sub]++
+	writeJSON(w, http.StatusOK, e.metadata(secretID))
+}
+
+func (s *Server) handleListEggs(w http.ResponseWriter, r *http.Request, sub string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL.Query().Get("view") == "trash" {
+		s.listTrash(w, r, sub)
+		return
+	}
+
+	// The ETag names the vault version; an unchanged vault is not resent
+	etag := fmt.Sprintf(`"v%d"`, s.versions[sub])
+	w.Header().Set("ETag", etag)
+	if r.URL.Query().Get(api.PageTokenParam) == "" && r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// Pages are in key order; the token is the last key of the previous page
+	ids := make([]string, 0, len(s.eggs[sub]))
+	for id := range s.eggs[sub] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	start := 0
+	if token := r.URL.Query().Get(api.PageTokenParam); token != "" {
+		after, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid "+api.PageTokenParam)
+			return
+		}
+		start = sort.SearchStrings(ids, string(after)+"\x00")
+	}
+	end := min(start+s.pageSize, len(ids))
+	page := ids[start:end]
+
+	next := ""
+	if end < len(ids) {
+		next = base64.RawURLEncoding.EncodeToString([]byte(page[len(page)-1]))
+	}
+
+	if r.URL.Query().Get("view") == "metadata" {
+		resp := api.ListEggsResponse{Eggs: []api.EggMetadata{}, NextToken: next}
+		for _, id := range page {
+			resp.Eggs = append(resp.Eggs, s.eggs[sub][id].metadata(id))
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	resp := api.GetEggsResponse{Eggs: []api.GetEggResponse{}, NextToken: next}
+	for _, id := range page {
+		resp.Eggs = append(resp.Eggs, s.eggs[sub][id].response(sub, id))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// listTrash serves one page of the trash, in key order; the caller holds s.mu
+func (s *Server) listTrash(w http.ResponseWriter, r *http.Request, sub string) {
+	s.expireTrash(sub)
+	ids := make([]string, 0, len(s.trash[sub]))
+	for id := range s.trash[sub] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	start := 0
+	if token := r.URL.Query().Get(api.PageTokenParam); token != "" {
+		after, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid "+api.PageTokenParam)
+			return
+		}
+		start = sort.SearchStrings(ids, string(after)+"\x00")
+	}
+	end := min(start+s.pageSize, len(ids))
+
+	resp := api.TrashResponse{Eggs: []api.TrashedEgg{}, RetentionSeconds: int64(max(s.trashTTL, 0) / time.Second)}
+	for _, id := range ids[start:end] {
+		e := s.trash[sub][id]
+		resp.Eggs = append(resp.Eggs, api.TrashedEgg{
+			SecretID:  id,
+			DeletedAt: e.deletedAt.Format(time.RFC3339),
+			PurgeAt:   e.deletedAt.Add(s.trashTTL).Format(time.RFC3339),
+			Version:   e.version,
+			Size:      len(e.plaintext),
+		})
+	}
+	if end < len(ids) {
+		resp.NextToken = base64.RawURLEncoding.EncodeToString([]byte(ids[end-1]))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleBreakEgg(w http.ResponseWriter, r *http.Request, sub string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secretID := r.PathValue("key")
+	s.expireTrash(sub)
+	e, live := s.eggs[sub][secretID]
+
+	// ?purge=true deletes for good, from the vault or the trash
+	if r.URL.Query().Get("purge") == "true" {
+		_, trashed := s.trash[sub][secretID]
+		if !live && !trashed {
+			writeError(w, http.StatusNotFound, "EGG_NOT_FOUND", "secret does not exist")
+			return
+		}
+		delete(s.eggs[sub], secretID)
+		delete(s.trash[sub], secretID)
+		s.versions[sub]++
+		writeJSON(w, http.StatusOK, map[string]string{"message": "egg purged"})
+		return
+	}
+
+	if !live {
+		writeError(w, http.StatusNotFound, "EGG_NOT_FOUND", "secret does not exist")
+		return
+	}
+	if !preconditionMet(r, e) {
+		writeErrorBody(w, http.StatusPreconditionFailed, map[string]any{"error": "the secret has changed", "code": "VERSION_MISMATCH", "current": e.metadata(secretID)})
+		return
+	}
+	delete(s.eggs[sub], secretID)
+	s.versions[sub]++
+	if s.trashTTL <= 0 {
+		writeJSON(w, http.StatusOK, map[string]string{"message": "egg deleted"})
+		return
+	}
+	if s.trash[sub] == nil {
+		s.trash[sub] = map[string]*egg{}
+	}
+	e.deletedAt = time.Now().UTC()
+	s.trash[sub][secretID] = e
+	writeJSON(w, http.StatusOK, map[string]string{"message": "egg moved to trash"})
+}
+
+func (s *Server) handleRestoreEgg(w http.ResponseWriter, r *http.Request, sub string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secretID := r.PathValue("key")
+	s.expireTrash(sub)
+	e, ok := s.trash[sub][secretID]
+	if !ok {
+		writeError(w, http.StatusNotFound, "EGG_NOT_FOUND", "secret is not in the trash")
+		return
+	}
+	if _, live := s.eggs[sub][secretID]; live {
+		writeError(w, http.StatusConflict, "EGG_EXISTS", "a secret with this key exists")
+		return
+	}
+
+	delete(s.trash[sub], secretID)
+	e.deletedAt = time.Time{}
+	if s.eggs[sub] == nil {
+		s.eggs[sub] = map[string]*egg{}
+	}
+	s.eggs[sub][secretID] = e
+	s.versions[sub]++
+	writeJSON(w, http.StatusOK, map[string]string{"message": "egg restored"})
+}
+
+// expireTrash drops secrets kept past the retention window; the caller
+// holds s.mu
+func (s *Server) expireTrash(owner string) {
+	cutoff := time.Now().Add(-s.trashTTL)
+	for id, e := range s.trash[owner] {
+		if e.deletedAt.Before(cutoff) {
+			delete(s.trash[owner], id)
+		}
+	}
+}
+
+// put stores a new version of a secret written by author; the caller holds s.mu
+func (s *Server) put(owner, author string, req api.PutEggRequest) {
+	now := time.Now().UTC()
+	s.versions[owner]++
+	if s.eggs[owner] == nil {
+		s.eggs[owner] = map[string]*egg{}
+	}
+	e, ok := s.eggs[owner][req.SecretID]
+	if !ok {
+		e = &egg{createdAt: now}
+		s.eggs[owner][req.SecretID] = e
+	}
+	e.plaintext = req.Plaintext
+	if req.Metadata != nil {
+		e.meta.Description = cmp.Or(req.Metadata.Description, e.meta.Description)
+		e.meta.OwnerTeam = cmp.Or(req.Metadata.OwnerTeam, e.meta.OwnerTeam)
+		e.meta.ExpiresAt = cmp.Or(req.Metadata.ExpiresAt, e.meta.ExpiresAt)
+		e.meta.RotatedAt = cmp.Or(req.Metadata.RotatedAt, e.meta.RotatedAt)
+		e.meta.Tags = mergeTags(e.meta.Tags, req.Metadata.Tags)
+	}
+	e.version++
+	e.updatedAt = now
+	e.history = append(e.history, api.EggVersion{
+		Version:   e.version,
+		WrittenAt: now.Format(time.RFC3339Nano),
+		Author:    author,
+		Note:      req.Note,
+		Size:      len(req.Plaintext),
+		Plaintext: req.Plaintext,
+	})
+}
+
+// mergeTags returns tags with set added or overwritten, as a new map
+func mergeTags(tags, set map[string]string) map[string]string {
+	if len(set) == 0 {
+		return tags
+	}
+	merged := make(map[string]string, len(tags)+len(set))
+	maps.Copy(merged, tags)
+	maps.Copy(merged, set)
+	return merged
+}
+
+func (e *egg) response(owner, secretID string) api.GetEggResponse {
+	return api.GetEggResponse{
+		Owner:          owner,
+		SecretID:       secretID,
+		Plaintext:      e.plaintext,
+		CreatedAt:      e.createdAt.Format(time.RFC3339),
+		UpdatedAt:      e.updatedAt.Format(time.RFC3339Nano),
+		Version:        e.version,
+		SecretMetadata: e.meta,
+	}
+}
+
+func (e *egg) metadata(secretID string) api.EggMetadata {
+	return api.EggMetadata{
+		SecretID:       secretID,
+		CreatedAt:      e.createdAt.Format(time.RFC3339),
+		UpdatedAt:      e.updatedAt.Format(time.RFC3339Nano),
+		Version:        e.version,
+		Size:           len(e.plaintext),
+		SecretMetadata: e.meta,
+	}
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error body in the shape the real API uses
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeErrorBody(w, status, map[string]any{"error": message, "code": code})
+}
+
+// writeErrorBody writes an API error with a custom body
+func writeErrorBody(w http.ResponseWriter, status int, body map[string]any) {
+	w.Header().Set("X-Amzn-Requestid", "eggtest-"+strconv.FormatInt(time.Now().UnixNano(), 36))
+	writeJSON(w, status, body)
+}
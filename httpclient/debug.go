@@ -0,0 +1,225 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Redacted replaces every sensitive value in debug output
+const Redacted = "[REDACTED]"
+
+// maxDebugBody caps how much of each body is logged
+const maxDebugBody = 16 << 10
+
+// sensitiveFields are JSON fields, form fields and query parameters whose
+// values are never logged
+var sensitiveFields = map[string]bool{
+	"plaintext":     true,
+	"access_token":  true,
+	"id_token":      true,
+	"refresh_token": true,
+	"client_secret": true,
+	"password":      true,
+}
+
+// sensitiveParams are only secret as form fields and query parameters. In
+// JSON, "code" is the API's error code, which is worth seeing.
+var sensitiveParams = map[string]bool{
+	"code":          true,
+	"code_verifier": true,
+}
+
+// sensitiveHeaders are headers whose values are never logged
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+}
+
+// jwtPattern catches tokens that turn up somewhere unexpected, such as in
+// an error message
+var jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+
+// debugTransport logs each request and response, with secrets redacted
+type debugTransport struct {
+	base http.RoundTripper
+	out  io.Writer
+	mu   sync.Mutex // Keeps concurrent exchanges from interleaving
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var b strings.Builder
+
+	// 1. The request, read and then replayed to the base transport
+	reqBody, err := drainBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&b, "--> %s %s\n", req.Method, redactURL(req.URL))
+	writeHeaders(&b, req.Header)
+	writeBody(&b, req.Header.Get("Content-Type"), reqBody)
+
+	// 2. The response, or the transport error
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	elapsed := time.Since(start).Round(time.Millisecond)
+
+	if err != nil {
+		fmt.Fprintf(&b, "<-- %s %s failed after %s: %s\n", req.Method, redactURL(req.URL), elapsed, redactText(err.Error()))
+	} else {
+		respBody, readErr := drainBody(&resp.Body)
+		fmt.Fprintf(&b, "<-- %s %s %s (%s)\n", resp.Status, req.Method, redactURL(req.URL), elapsed)
+		writeHeaders(&b, resp.Header)
+		writeBody(&b, resp.Header.Get("Content-Type"), respBody)
+		if readErr != nil {
+			fmt.Fprintf(&b, "    (failed to read body: %v)\n", readErr)
+		}
+	}
+
+	t.mu.Lock()
+	io.WriteString(t.out, b.String()+"\n")
+	t.mu.Unlock()
+
+	return resp, err
+}
+
+// drainBody reads *body and replaces it with a copy that can be read again
+func drainBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	data, err := io.ReadAll(*body)
+	(*body).Close()
+	*body = io.NopCloser(bytes.NewReader(data))
+	return data, err
+}
+
+// redactURL hides sensitive query parameters
+func redactURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Redacted()
+	}
+	redacted := *u
+	query := u.Query()
+	redactValues(query)
+	redacted.RawQuery = encodeRedacted(query)
+	return redacted.Redacted()
+}
+
+// redactValues hides sensitive form fields or query parameters in place
+func redactValues(values url.Values) {
+	for key := range values {
+		if sensitiveFields[strings.ToLower(key)] || sensitiveParams[strings.ToLower(key)] {
+			values[key] = []string{Redacted}
+		}
+	}
+}
+
+// encodeRedacted encodes values, leaving the redaction marker readable
+func encodeRedacted(values url.Values) string {
+	return strings.ReplaceAll(values.Encode(), url.QueryEscape(Redacted), Redacted)
+}
+
+// writeHeaders logs headers in a stable order
+func writeHeaders(b *strings.Builder, header http.Header) {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, value := range header[key] {
+			switch {
+			case sensitiveHeaders[http.CanonicalHeaderKey(key)]:
+				// Keep the scheme ("Bearer") since it helps debugging
+				if scheme, _, ok := strings.Cut(value, " "); ok && strings.HasSuffix(key, "Authorization") {
+					value = scheme + " " + Redacted
+				} else {
+					value = Redacted
+				}
+			case key == "Location":
+				if u, err := url.Parse(value); err == nil {
+					value = redactURL(u)
+				}
+			default:
+				value = redactText(value)
+			}
+			fmt.Fprintf(b, "    %s: %s\n", key, value)
+		}
+	}
+}
+
+// writeBody logs a body. JSON and form bodies are logged with sensitive
+// fields redacted; anything else is only described, since it cannot be
+// redacted reliably.
+func writeBody(b *strings.Builder, contentType string, body []byte) {
+	if len(body) == 0 {
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	var text string
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			text = fmt.Sprintf("[%d bytes of unparsable form data]", len(body))
+			break
+		}
+		redactValues(values)
+		text = encodeRedacted(values)
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") || json.Valid(body):
+		var doc any
+		if err := json.Unmarshal(body, &doc); err != nil {
+			text = fmt.Sprintf("[%d bytes of invalid JSON]", len(body))
+			break
+		}
+		redacted, _ := json.Marshal(redactJSON(doc))
+		text = redactText(string(redacted))
+	default:
+		text = fmt.Sprintf("[%d bytes of %s]", len(body), contentType)
+	}
+
+	if len(text) > maxDebugBody {
+		text = text[:maxDebugBody] + fmt.Sprintf("... (%d bytes truncated)", len(text)-maxDebugBody)
+	}
+	fmt.Fprintf(b, "    %s\n", text)
+}
+
+// redactJSON hides sensitive fields anywhere in a decoded JSON document
+func redactJSON(doc any) any {
+	switch v := doc.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if sensitiveFields[strings.ToLower(key)] {
+				v[key] = Redacted
+				continue
+			}
+			v[key] = redactJSON(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redactJSON(value)
+		}
+	}
+	return doc
+}
+
+// redactText hides anything that looks like a JWT
+func redactText(s string) string {
+	return jwtPattern.ReplaceAllString(s, Redacted)
+}
@@ -0,0 +1,151 @@
+// Package httpclient builds the HTTP client every outbound call of the CLI
+// shares, so proxies, private CAs and client certificates only have to be
+// configured once.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"time"
+)
+
+// ProxyDirect disables proxying, even when the proxy environment variables
+// are set
+const ProxyDirect = "direct"
+
+// Options configures the shared client
+type Options struct {
+	// Proxy is a proxy URL or ProxyDirect. Empty means follow HTTPS_PROXY,
+	// HTTP_PROXY and NO_PROXY.
+	Proxy string
+
+	// CABundles are PEM files trusted in addition to the system roots, for
+	// TLS-intercepting proxies and internal CAs
+	CABundles []string
+
+	// ClientCert and ClientKey are PEM files presented for mutual TLS
+	ClientCert string
+	ClientKey  string
+
+	UserAgent string
+	Timeout   time.Duration // Per request; 0 means no limit
+
+	// Debug, when set, receives a trace of every request and response with
+	// tokens, codes and secret values redacted
+	Debug io.Writer
+}
+
+// UserAgent returns the User-Agent the CLI sends, e.g.
+// "egg-cli/1.4.0 (linux/amd64; go1.25.4)"
+func UserAgent(version string) string {
+	return fmt.Sprintf("egg-cli/%s (%s/%s; %s)", version, runtime.GOOS, runtime.GOARCH, runtime.Version())
+}
+
+// New builds a client from opts. Every request it sends carries the
+// User-Agent, unless the request sets its own.
+func New(opts Options) (*http.Client, error) {
+	proxy, err := opts.ProxyFunc()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := opts.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	transport.TLSClientConfig = tlsConfig
+
+	// The debug transport goes next to the network, after every transport
+	// that changes the request, so --debug traces the request as sent,
+	// User-Agent included
+	var rt http.RoundTripper = transport
+	if opts.Debug != nil {
+		rt = &debugTransport{base: rt, out: opts.Debug}
+	}
+	if opts.UserAgent != "" {
+		rt = &userAgentTransport{base: rt, userAgent: opts.UserAgent}
+	}
+	return &http.Client{Transport: rt, Timeout: opts.Timeout}, nil
+}
+
+// ProxyFunc returns the proxy selection function for opts.Proxy
+func (opts Options) ProxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	switch opts.Proxy {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case ProxyDirect:
+		return nil, nil
+	}
+
+	proxyURL, err := url.Parse(opts.Proxy)
+	if err != nil || proxyURL.Scheme == "" || proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: want a URL such as http://proxy.corp:3128", opts.Proxy)
+	}
+	return http.ProxyURL(proxyURL), nil
+}
+
+// TLSConfig returns the TLS settings for opts, or nil when the defaults
+// (system roots, no client certificate) apply
+func (opts Options) TLSConfig() (*tls.Config, error) {
+	if len(opts.CABundles) == 0 && opts.ClientCert == "" && opts.ClientKey == "" {
+		return nil, nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	// 1. Extra CA bundles on top of the system roots
+	if len(opts.CABundles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, path := range opts.CABundles {
+			pem, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("CA bundle %s contains no PEM certificates", path)
+			}
+		}
+		config.RootCAs = pool
+	}
+
+	// 2. Client certificate for mutual TLS
+	if opts.ClientCert != "" || opts.ClientKey != "" {
+		if opts.ClientCert == "" || opts.ClientKey == "" {
+			return nil, errors.New("mutual TLS needs both a client certificate and a client key")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// userAgentTransport sets the User-Agent header on outgoing requests
+type userAgentTransport struct {
+	base      http.RoundTripper
+	userAgent string
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		// A RoundTripper must not modify the caller's request
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	return t.base.RoundTrip(req)
+}
@@ -1,13 +1,24 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/owenHochwald/egg-carton/cli/commands"
 	"github.com/spf13/cobra"
 )
 
+// Build information, set by the Makefile with -ldflags
+var (
+	Version   = "dev"
+	BuildTime = "unknown"
+	GitCommit = "unknown"
+)
+
 var rootCmd = &cobra.Command{
 	Use:   "egg",
 	Short: "🥚 EggCarton - Secure secret management CLI",
@@ -16,25 +27,78 @@ var rootCmd = &cobra.Command{
 Commands:
   🔐 login           - Authenticate with OAuth
   🐔 lay (add)       - Store a secret (lay an egg)
+  ✏️  edit            - Edit a secret in your $EDITOR
   🥚 get             - Retrieve secrets from your vault
+  📋 list (ls)       - List secret names and metadata, never values
+  🏷️  meta            - Show or change a secret's description, team and tags
+  ⏳ expiring        - List secrets that have expired, expire soon or are due for rotation
+  🔁 rotate          - Replace a secret with a new value via a rotator script
+  📜 history         - Show a secret's earlier versions
+  ⏪ rollback        - Restore an earlier version of a secret
   🐣 hatch (run)     - Inject secrets and run a command (hatch your eggs)
-  💥 break           - Delete a secret from your vault
+  💥 break           - Move secrets to the trash, or --purge them
+  🗑️  trash           - List deleted secrets that can still be restored
+  ♻️  restore         - Bring a deleted secret back from the trash
+  ⚙️  config          - Manage configuration profiles
+  🔄 sync            - Refresh the local copy and push offline changes
+  🧭 status          - Show your session, local copy and queued changes
+  🗄️  cache           - Manage the encrypted local vault cache
+  🩺 doctor          - Diagnose configuration and connectivity
 
 It uses AWS Lambda, DynamoDB, and KMS for encryption,
 with Cognito authentication via OAuth PKCE flow.`,
+	// main prints errors itself so cancellations can be reported cleanly
+	SilenceErrors: true,
+	// Flags and arguments are valid once a command runs, so its errors
+	// are not usage mistakes and shouldn't print the usage
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		cmd.SilenceUsage = true
+	},
 }
 
 func main() {
+	// Report the build in --version and the User-Agent
+	rootCmd.Version = fmt.Sprintf("%s (commit %s, built %s)", Version, GitCommit, BuildTime)
+	commands.SetVersion(Version)
+
+	// Register global flags
+	commands.AddGlobalFlags(rootCmd)
+
 	// Add all subcommands
 	rootCmd.AddCommand(commands.LoginCmd)
 	rootCmd.AddCommand(commands.AddCmd)
+	rootCmd.AddCommand(commands.EditCmd)
 	rootCmd.AddCommand(commands.GetCmd)
+	rootCmd.AddCommand(commands.ListCmd)
+	rootCmd.AddCommand(commands.MetaCmd)
+	rootCmd.AddCommand(commands.ExpiringCmd)
+	rootCmd.AddCommand(commands.RotateCmd)
+	rootCmd.AddCommand(commands.HistoryCmd)
+	rootCmd.AddCommand(commands.RollbackCmd)
 	rootCmd.AddCommand(commands.BreakCmd)
+	rootCmd.AddCommand(commands.TrashCmd)
+	rootCmd.AddCommand(commands.RestoreCmd)
 	rootCmd.AddCommand(commands.RunCmd)
+	rootCmd.AddCommand(commands.ConfigCmd)
+	rootCmd.AddCommand(commands.SyncCmd)
+	rootCmd.AddCommand(commands.StatusCmd)
+	rootCmd.AddCommand(commands.CacheCmd)
+	rootCmd.AddCommand(commands.DoctorCmd)
+
+	// Execute the root command, cancelling in-flight requests on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
 
-	// Execute the root command
-	if err := rootCmd.Execute(); err != nil {
+	switch {
+	case err == nil:
+		return
+	case errors.Is(err, context.Canceled):
+		fmt.Fprintln(os.Stderr, "Error: interrupted")
+	case errors.Is(err, context.DeadlineExceeded):
+		fmt.Fprintln(os.Stderr, "Error: timed out waiting for the server (raise the limit with --timeout)")
+	default:
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
 	}
+	os.Exit(commands.ExitCode(err))
 }
@@ -3,67 +3,2100 @@ package main_test
 // This file contains example tests you can write as you develop each component
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
-	// Import your packages as you implement them
+	"time"
+
+	"github.com/owenHochwald/egg-carton/cli/api"
+	"github.com/owenHochwald/egg-carton/cli/auth"
+	"github.com/owenHochwald/egg-carton/cli/cache"
+	"github.com/owenHochwald/egg-carton/cli/commands"
+	"github.com/owenHochwald/egg-carton/cli/config"
+	"github.com/owenHochwald/egg-carton/cli/eggtest"
+	"github.com/owenHochwald/egg-carton/cli/httpclient"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
+// newTestConfig points every egg directory at a temp dir and returns a config
+func newTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv(config.EggHomeEnv, home)
+	t.Setenv("API_ENDPOINT", "https://api.example.com")
+	t.Setenv("COGNITO_USER_POOL_ID", "us-west-1_test")
+	t.Setenv("COGNITO_CLIENT_ID", "test-client")
+	t.Setenv("COGNITO_DOMAIN", "auth.example.com")
+	t.Setenv("COGNITO_REGION", "us-west-1")
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if filepath.Dir(cfg.TokenPath) != home {
+		t.Fatalf("TokenPath %s is not under EGG_HOME %s", cfg.TokenPath, home)
+	}
+	return cfg
+}
+
+// newFakeConfig is newTestConfig pointed at an eggtest fake deployment
+func newFakeConfig(t *testing.T, srv *eggtest.Server) *config.Config {
+	t.Helper()
+
+	fake := srv.Config()
+	t.Setenv(config.EggHomeEnv, t.TempDir())
+	t.Setenv("API_ENDPOINT", fake.APIEndpoint)
+	t.Setenv("COGNITO_USER_POOL_ID", fake.CognitoConfig.UserPoolID)
+	t.Setenv("COGNITO_CLIENT_ID", fake.CognitoConfig.ClientID)
+	t.Setenv("COGNITO_DOMAIN", fake.CognitoConfig.Domain)
+	t.Setenv("COGNITO_REGION", fake.CognitoConfig.Region)
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	return cfg
+}
+
+// newEggRunner returns a function that runs the CLI with the given
+// subcommands. Their flags, and those of their own subcommands, are reset
+// before every run, since cobra keeps flag values in package variables
+// between executions.
+func newEggRunner(subcommands ...*cobra.Command) func(args ...string) error {
+	var reset func(cmd *cobra.Command)
+	reset = func(cmd *cobra.Command) {
+		cmd.Flags().VisitAll(func(f *pflag.Flag) {
+			if slice, ok := f.Value.(pflag.SliceValue); ok {
+				slice.Replace(nil)
+			} else {
+				f.Value.Set(f.DefValue)
+			}
+			f.Changed = false
+		})
+		for _, sub := range cmd.Commands() {
+			reset(sub)
+		}
+	}
+	return func(args ...string) error {
+		root := &cobra.Command{Use: "egg", SilenceErrors: true, SilenceUsage: true}
+		commands.AddGlobalFlags(root)
+		for _, cmd := range subcommands {
+			reset(cmd)
+			root.AddCommand(cmd)
+		}
+		root.SetArgs(args)
+		return root.Execute()
+	}
+}
+
+// captureStdout runs fn with os.Stdout redirected and returns what it printed
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	return captureFile(t, &os.Stdout, fn)
+}
+
+// captureStderr runs fn with os.Stderr redirected and returns what it printed
+func captureStderr(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	return captureFile(t, &os.Stderr, fn)
+}
+
+// captureFile runs fn with *f redirected to a pipe and returns what was
+// written to it
+func captureFile(t *testing.T, f **os.File, fn func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := *f
+	*f = w
+	defer func() { *f = saved }()
+
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- data
+	}()
+	runErr := fn()
+	w.Close()
+	return string(<-done), runErr
+}
+
 // Phase 1 Tests - Config
 func TestConfigLoadTokens(t *testing.T) {
-	// TODO: Test loading tokens from file
-	t.Skip("Implement this after config.LoadTokens()")
+	cfg := newTestConfig(t)
+
+	if _, err := cfg.LoadTokens(); err == nil {
+		t.Fatal("expected an error before any tokens are saved")
+	}
+
+	want := &config.TokenData{AccessToken: "access", RefreshToken: "refresh", ExpiresIn: 3600, IssuedAt: 42}
+	if err := cfg.SaveTokens(want); err != nil {
+		t.Fatalf("SaveTokens: %v", err)
+	}
+
+	got, err := cfg.LoadTokens()
+	if err != nil {
+		t.Fatalf("LoadTokens: %v", err)
+	}
+	if got.AccessToken != want.AccessToken || got.RefreshToken != want.RefreshToken || got.IssuedAt != want.IssuedAt {
+		t.Fatalf("LoadTokens = %+v, want %+v", got, want)
+	}
 }
 
 func TestConfigSaveTokens(t *testing.T) {
-	// TODO: Test saving tokens with correct permissions
-	t.Skip("Implement this after config.SaveTokens()")
+	cfg := newTestConfig(t)
+
+	if err := cfg.SaveTokens(&config.TokenData{AccessToken: "access"}); err != nil {
+		t.Fatalf("SaveTokens: %v", err)
+	}
+
+	info, err := os.Stat(cfg.TokenPath)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Fatalf("credentials permissions = %o, want 600", perm)
+	}
+}
+
+func TestConfigCredentialsSchema(t *testing.T) {
+	cfg := newTestConfig(t)
+
+	// Files from before schema_version existed are upgraded with a backup
+	legacy := []byte(`{"access_token": "old", "refresh_token": "r"}`)
+	if err := os.WriteFile(cfg.TokenPath, legacy, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := cfg.LoadTokens()
+	if err != nil {
+		t.Fatalf("LoadTokens: %v", err)
+	}
+	if tokens.AccessToken != "old" || tokens.SchemaVersion != 1 {
+		t.Fatalf("migrated tokens = %+v", tokens)
+	}
+	if backup, err := os.ReadFile(cfg.TokenPath + ".v0.bak"); err != nil || string(backup) != string(legacy) {
+		t.Fatalf("backup = %q, %v", backup, err)
+	}
+
+	// Files from a newer release are refused untouched
+	newer := []byte(`{"schema_version": 99, "access_token": "new"}`)
+	if err := os.WriteFile(cfg.TokenPath, newer, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.LoadTokens(); !errors.Is(err, config.ErrNewerSchema) {
+		t.Fatalf("LoadTokens error = %v, want ErrNewerSchema", err)
+	}
+}
+
+// newEmptyHome points every egg directory at an empty temp dir, with no
+// settings coming from the environment, and returns config.json's path
+func newEmptyHome(t *testing.T) string {
+	t.Helper()
+
+	t.Setenv(config.EggHomeEnv, t.TempDir())
+	for _, env := range []string{config.ProfileEnv, "API_ENDPOINT", "COGNITO_USER_POOL_ID", "COGNITO_CLIENT_ID", "COGNITO_DOMAIN", "COGNITO_REGION"} {
+		t.Setenv(env, "")
+	}
+	path, err := config.ConfigFilePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigProfiles(t *testing.T) {
+	path := newEmptyHome(t)
+
+	// A flat v1 config becomes the default profile, with a backup
+	v1 := []byte(`{"schema_version": 1, "api_endpoint": "https://v1.example.com",
+		"cognito": {"user_pool_id": "pool", "client_id": "client", "domain": "auth.example.com", "region": "us-east-1"}}`)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, v1, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig of a v1 config: %v", err)
+	}
+	if cfg.Profile != config.DefaultProfile || cfg.APIEndpoint != "https://v1.example.com" || cfg.CognitoConfig.Region != "us-east-1" {
+		t.Fatalf("migrated config = %+v", cfg)
+	}
+	if backup, err := os.ReadFile(path + ".v1.bak"); err != nil || string(backup) != string(v1) {
+		t.Fatalf("backup = %q, %v", backup, err)
+	}
+	file, err := config.ReadConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.CurrentProfile != config.DefaultProfile || len(file.Profiles) != 1 {
+		t.Fatalf("migrated file = %+v", file)
+	}
+
+	// Profiles are picked by name, then $EGG_PROFILE, then current_profile
+	staging := *file.Profiles[config.DefaultProfile]
+	staging.APIEndpoint = "https://staging.example.com"
+	file.Profiles["staging"] = &staging
+	if err := file.Save(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name, env, want string
+	}{
+		{"", "", config.DefaultProfile},
+		{"", "staging", "staging"},
+		{config.DefaultProfile, "staging", config.DefaultProfile},
+	} {
+		t.Setenv(config.ProfileEnv, tt.env)
+		cfg, err := config.LoadProfile(tt.name)
+		if err != nil {
+			t.Fatalf("LoadProfile(%q) with $%s=%q: %v", tt.name, config.ProfileEnv, tt.env, err)
+		}
+		if cfg.Profile != tt.want {
+			t.Errorf("LoadProfile(%q) with $%s=%q picked %q, want %q", tt.name, config.ProfileEnv, tt.env, cfg.Profile, tt.want)
+		}
+	}
+	t.Setenv(config.ProfileEnv, "")
+
+	// Each profile has its own credentials
+	defaultCfg, err := config.LoadProfile(config.DefaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stagingCfg, err := config.LoadProfile("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stagingCfg.APIEndpoint != "https://staging.example.com" || stagingCfg.TokenPath == defaultCfg.TokenPath ||
+		filepath.Base(defaultCfg.TokenPath) != "credentials.json" {
+		t.Fatalf("staging = %+v, default = %+v", stagingCfg, defaultCfg)
+	}
+
+	// A mistyped profile is an error, whether picked by name or through
+	// the environment, and names can't escape the directory
+	if _, err := config.LoadProfileUnchecked("stagnig"); err == nil || !strings.Contains(err.Error(), `unknown profile "stagnig"`) {
+		t.Fatalf("LoadProfileUnchecked of an unknown profile = %v, want an unknown profile error", err)
+	}
+	t.Setenv(config.ProfileEnv, "prod")
+	if _, err := config.LoadProfile(""); err == nil || !strings.Contains(err.Error(), `unknown profile "prod"`) {
+		t.Fatalf("LoadProfile with $%s of an unknown profile = %v, want an unknown profile error", config.ProfileEnv, err)
+	}
+	t.Setenv(config.ProfileEnv, "")
+	if _, err := config.LoadProfile("../prod"); err == nil {
+		t.Fatal("LoadProfile accepted an invalid profile name")
+	}
+}
+
+func TestImportTerraform(t *testing.T) {
+	newEmptyHome(t)
+	egg := newEggRunner(commands.ConfigCmd)
+	write := func(outputs string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "outputs.json")
+		if err := os.WriteFile(path, []byte(outputs), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// The default output names, with a bare Cognito domain prefix
+	outputs := write(`{
+		"api_endpoint": {"sensitive": false, "value": "https://api.example.com"},
+		"cognito_user_pool_id": {"sensitive": false, "value": "eu-west-1_pool"},
+		"cognito_client_id": {"sensitive": true, "value": "client-1"},
+		"cognito_domain": {"sensitive": false, "value": "egg-carton"},
+		"cognito_region": {"sensitive": false, "value": "eu-west-1"},
+		"unrelated": {"sensitive": false, "value": ["ignored"]}
+	}`)
+
+	// A dry run shows the changes without saving them
+	out, err := captureStdout(t, func() error { return egg("--profile", "staging", "config", "import-terraform", "--dry-run", outputs) })
+	if err != nil || !strings.Contains(out, "Dry run: 5 setting(s) would change") {
+		t.Fatalf("dry run = %q, %v", out, err)
+	}
+	if _, err := config.LoadProfile("staging"); err == nil {
+		t.Fatal("a dry run saved the profile")
+	}
+
+	if err := egg("--profile", "staging", "config", "import-terraform", outputs); err != nil {
+		t.Fatalf("import-terraform: %v", err)
+	}
+	staging, err := config.LoadProfile("staging")
+	if err != nil {
+		t.Fatalf("LoadProfile after import: %v", err)
+	}
+	want := config.CognitoConfig{UserPoolID: "eu-west-1_pool", ClientID: "client-1", Domain: "egg-carton.auth.eu-west-1.amazoncognito.com", Region: "eu-west-1"}
+	if staging.APIEndpoint != "https://api.example.com" || staging.CognitoConfig != want {
+		t.Fatalf("imported profile = %+v", staging)
+	}
+	if file, err := config.ReadConfigFile(); err != nil || file.CurrentProfile != "staging" {
+		t.Fatalf("current profile after the first import = %+v, %v", file, err)
+	}
+	out, err = captureStdout(t, func() error { return egg("--profile", "staging", "config", "import-terraform", outputs) })
+	if err != nil || !strings.Contains(out, "already up to date") {
+		t.Fatalf("repeated import = %q, %v", out, err)
+	}
+
+	// Custom output names; a full domain URL keeps its host only
+	custom := write(`{
+		"endpoint": {"sensitive": false, "value": " https://prod.example.com "},
+		"auth_domain": {"sensitive": false, "value": "https://auth.example.com/"}
+	}`)
+	out, err = captureStdout(t, func() error {
+		return egg("--profile", "prod", "config", "import-terraform", "--api-endpoint-output", "endpoint", "--domain-output", "auth_domain", custom)
+	})
+	if err != nil || !strings.Contains(out, `output "cognito_region" not found`) || !strings.Contains(out, "Still missing") {
+		t.Fatalf("import with custom names = %q, %v", out, err)
+	}
+	file, err := config.ReadConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prod := file.Profiles["prod"]
+	if prod == nil || prod.APIEndpoint != "https://prod.example.com" || prod.CognitoConfig.Domain != "auth.example.com" {
+		t.Fatalf("prod profile = %+v", prod)
+	}
+	if file.CurrentProfile != "staging" {
+		t.Fatalf("current profile = %q, want the first import's", file.CurrentProfile)
+	}
+
+	// Outputs under other names, or of the wrong type, are errors
+	if err := egg("--profile", "prod", "config", "import-terraform", write(`{"other": {"value": "x"}}`)); err == nil {
+		t.Fatal("import without any expected output succeeded")
+	}
+	if err := egg("--profile", "prod", "config", "import-terraform", write(`{"api_endpoint": {"value": 42}}`)); err == nil {
+		t.Fatal("import of a non-string output succeeded")
+	}
 }
 
 func TestTokenIsValid(t *testing.T) {
-	// TODO: Test token expiration logic
-	t.Skip("Implement this after config.IsTokenValid()")
+	fresh := &config.TokenData{ExpiresIn: 3600, IssuedAt: time.Now().Unix()}
+	if !fresh.IsTokenValid() {
+		t.Error("freshly issued token should be valid")
+	}
+
+	// Inside the 5 minute refresh buffer
+	expiring := &config.TokenData{ExpiresIn: 3600, IssuedAt: time.Now().Add(-58 * time.Minute).Unix()}
+	if expiring.IsTokenValid() {
+		t.Error("token expiring within the buffer should be invalid")
+	}
 }
 
 // Phase 2 Tests - Auth
 func TestGeneratePKCEChallenge(t *testing.T) {
-	// TODO: Test PKCE generation
-	// Verify verifier length (43 chars)
-	// Verify challenge is SHA256 hash of verifier
-	t.Skip("Implement this after auth.GeneratePKCEChallenge()")
+	pkce, err := auth.GeneratePKCEChallenge()
+	if err != nil {
+		t.Fatalf("GeneratePKCEChallenge: %v", err)
+	}
+	if len(pkce.Verifier) != 43 {
+		t.Errorf("verifier length = %d, want 43", len(pkce.Verifier))
+	}
+	sum := sha256.Sum256([]byte(pkce.Verifier))
+	if want := base64.RawURLEncoding.EncodeToString(sum[:]); pkce.Challenge != want {
+		t.Errorf("challenge = %q, want %q", pkce.Challenge, want)
+	}
 }
 
 func TestBuildAuthorizationURL(t *testing.T) {
-	// TODO: Test URL building
-	// Verify all required parameters are present
-	t.Skip("Implement this after auth.BuildAuthorizationURL()")
+	raw := auth.BuildAuthorizationURL("https://auth.example.com/oauth2/authorize", "client", "http://localhost:8080/callback", "challenge")
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parse %q: %v", raw, err)
+	}
+	if u.Host != "auth.example.com" || u.Path != "/oauth2/authorize" {
+		t.Errorf("URL = %s", raw)
+	}
+
+	query := u.Query()
+	for param, want := range map[string]string{
+		"client_id":             "client",
+		"response_type":         "code",
+		"redirect_uri":          "http://localhost:8080/callback",
+		"code_challenge":        "challenge",
+		"code_challenge_method": "S256",
+		"scope":                 "openid email profile",
+	} {
+		if got := query.Get(param); got != want {
+			t.Errorf("%s = %q, want %q", param, got, want)
+		}
+	}
 }
 
 // Phase 3 Tests - API
 func TestExtractOwnerFromToken(t *testing.T) {
-	// TODO: Test JWT decoding
-	// Use a test JWT token
-	t.Skip("Implement this after api.ExtractOwnerFromToken()")
+	srv := eggtest.NewServer(t)
+
+	owner, err := api.ExtractOwnerFromToken(srv.IssueTokens("user-42").AccessToken)
+	if err != nil || owner != "user-42" {
+		t.Fatalf("ExtractOwnerFromToken = %q, %v, want user-42", owner, err)
+	}
+	if _, err := api.ExtractOwnerFromToken("not-a-jwt"); err == nil {
+		t.Fatal("expected an error for a malformed token")
+	}
 }
 
 func TestAPIClientPutEgg(t *testing.T) {
-	// TODO: Test API client (use httptest for mock server)
-	t.Skip("Implement this after api.PutEgg()")
+	// The first attempt hits a cold start; the retry must reuse the same key
+	var attempts int
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		keys = append(keys, r.Header.Get(api.IdempotencyKeyHeader))
+		if r.Method != http.MethodPost || r.URL.Path != "/eggs" || r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	client := api.NewClient(server.URL, "token")
+	if err := client.PutEgg(context.Background(), "owner", api.PutEggRequest{SecretID: "API_KEY", Plaintext: "abc123"}); err != nil {
+		t.Fatalf("PutEgg: %v", err)
+	}
+	if attempts != 2 {
+		t.Fatalf("attempts = %d, want 2", attempts)
+	}
+	if keys[0] == "" || keys[0] != keys[1] {
+		t.Fatalf("idempotency keys = %q, want one non-empty key reused", keys)
+	}
+}
+
+func TestAPIClientTypedErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Amzn-Requestid", "req-1")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": "secret does not exist", "code": "EGG_NOT_FOUND"}`))
+	}))
+	defer server.Close()
+
+	err := api.NewClient(server.URL, "token").BreakEgg(context.Background(), "owner", "MISSING")
+	if !errors.Is(err, api.ErrNotFound) {
+		t.Fatalf("BreakEgg error = %v, want ErrNotFound", err)
+	}
+
+	var apiErr *api.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("BreakEgg error %T is not an *api.APIError", err)
+	}
+	if apiErr.Code != "EGG_NOT_FOUND" || apiErr.Message != "secret does not exist" || apiErr.RequestID != "req-1" {
+		t.Fatalf("APIError = %+v", apiErr)
+	}
+}
+
+func TestIsUnavailable(t *testing.T) {
+	ctx := context.Background()
+
+	// A certificate the client doesn't trust is not an outage
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsServer.Close()
+	_, untrusted := api.NewClient(tlsServer.URL, "token").GetEggByKey(ctx, "owner", "API_KEY")
+
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closed.Close()
+	_, refused := api.NewClient(closed.URL, "token").GetEggByKey(ctx, "owner", "API_KEY")
+
+	for _, tt := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"canceled", context.Canceled, false},
+		{"deadline", fmt.Errorf("failed to get egg: %w", context.DeadlineExceeded), true},
+		{"server error", &api.APIError{StatusCode: http.StatusBadGateway}, true},
+		{"not found", &api.APIError{StatusCode: http.StatusNotFound}, false},
+		{"connection refused", refused, true},
+		{"unknown host", &url.Error{Op: "Get", URL: "https://egg.invalid", Err: &net.DNSError{Err: "no such host", Name: "egg.invalid", IsNotFound: true}}, true},
+		{"untrusted certificate", untrusted, false},
+		{"hostname mismatch", &url.Error{Op: "Get", URL: "https://egg.example", Err: x509.HostnameError{Certificate: tlsServer.Certificate(), Host: "egg.example"}}, false},
+		{"connection reset", &url.Error{Op: "Get", URL: "https://egg.example", Err: &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}}, false},
+	} {
+		if got := api.IsUnavailable(tt.err); got != tt.want {
+			t.Errorf("IsUnavailable(%s: %v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestAPIClientPagination(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get(api.PageTokenParam)
+		requests = append(requests, token)
+		switch token {
+		case "":
+			w.Write([]byte(`{"eggs": [{"secret_id": "A"}, {"secret_id": "B"}], "next_token": "page2"}`))
+		case "page2":
+			w.Write([]byte(`{"eggs": [{"secret_id": "C"}]}`))
+		default:
+			t.Errorf("unexpected page token %q", token)
+		}
+	}))
+	defer server.Close()
+
+	client := api.NewClient(server.URL, "token")
+	eggs, err := client.GetEgg(context.Background(), "owner")
+	if err != nil {
+		t.Fatalf("GetEgg: %v", err)
+	}
+	if len(eggs) != 3 || eggs[2].SecretID != "C" {
+		t.Fatalf("GetEgg = %+v, want A, B, C", eggs)
+	}
+
+	// Stopping early must not fetch the next page
+	requests = nil
+	for egg, err := range client.AllEggs(context.Background(), "owner") {
+		if err != nil || egg.SecretID != "A" {
+			t.Fatalf("first egg = %+v, %v", egg, err)
+		}
+		break
+	}
+	if len(requests) != 1 {
+		t.Fatalf("fetched %d pages, want 1", len(requests))
+	}
+}
+
+func TestSecretKeyGrammar(t *testing.T) {
+	for key, valid := range map[string]bool{
+		"API_KEY": true, "_private": true, "db2_pass": true,
+		"": false, "2FA_SEED": false, "my key": false, "a/b": false, "path": false, "EGG_HOME": false,
+	} {
+		err := api.ValidateSecretKey(key)
+		if (err == nil) != valid {
+			t.Errorf("ValidateSecretKey(%q) = %v, want valid=%v", key, err, valid)
+		}
+		if err != nil && !errors.Is(err, api.ErrValidation) {
+			t.Errorf("ValidateSecretKey(%q) error does not match ErrValidation", key)
+		}
+	}
+
+	if got := api.SuggestSecretKey("stripe secret-key"); got != "stripe_secret_key" {
+		t.Errorf("SuggestSecretKey = %q", got)
+	}
+}
+
+func TestAPIClientEscapesKeys(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+	}))
+	defer server.Close()
+
+	if err := api.NewClient(server.URL, "token").BreakEgg(context.Background(), "owner", "a/b?c#d e+é"); err != nil {
+		t.Fatalf("BreakEgg: %v", err)
+	}
+	if want := "/eggs/owner/a%2Fb%3Fc%23d%20e%2B%C3%A9"; path != want {
+		t.Fatalf("path = %s, want %s", path, want)
+	}
+}
+
+func TestHTTPClientCABundleAndUserAgent(t *testing.T) {
+	var userAgent string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+	}))
+	defer server.Close()
+
+	// The test server's certificate stands in for an internal CA
+	bundle := filepath.Join(t.TempDir(), "corp-ca.pem")
+	pemCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(bundle, pemCert, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	untrusted, err := httpclient.New(httpclient.Options{Proxy: httpclient.ProxyDirect})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := untrusted.Get(server.URL); err == nil {
+		t.Fatal("expected an unknown authority error without the CA bundle")
+	}
+
+	client, err := httpclient.New(httpclient.Options{
+		Proxy:     httpclient.ProxyDirect,
+		CABundles: []string{bundle},
+		UserAgent: httpclient.UserAgent("1.2.3"),
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET with CA bundle: %v", err)
+	}
+	resp.Body.Close()
+	if !strings.HasPrefix(userAgent, "egg-cli/1.2.3 ") {
+		t.Fatalf("User-Agent = %q", userAgent)
+	}
+
+	// --debug traces the User-Agent that was actually sent
+	var trace bytes.Buffer
+	debugClient, err := httpclient.New(httpclient.Options{
+		Proxy:     httpclient.ProxyDirect,
+		CABundles: []string{bundle},
+		UserAgent: httpclient.UserAgent("1.2.3"),
+		Debug:     &trace,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if resp, err = debugClient.Get(server.URL); err != nil {
+		t.Fatalf("GET with --debug: %v", err)
+	}
+	resp.Body.Close()
+	if !strings.Contains(trace.String(), "User-Agent: "+userAgent+"\n") {
+		t.Fatalf("--debug trace lacks the User-Agent %q sent:\n%s", userAgent, trace.String())
+	}
+
+	// Half an mTLS configuration is a mistake worth reporting
+	if _, err := httpclient.New(httpclient.Options{ClientCert: bundle}); err == nil {
+		t.Fatal("expected an error for a client certificate without a key")
+	}
+}
+
+func TestDebugTraceRedactsSecrets(t *testing.T) {
+	srv := eggtest.NewServer(t)
+	tokens := srv.IssueTokens("user-1")
+
+	var trace bytes.Buffer
+	client, err := httpclient.New(httpclient.Options{Debug: &trace})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	store := api.NewClient(srv.URL, tokens.AccessToken, api.WithHTTPClient(client))
+	if err := store.PutEgg(ctx, "user-1", api.PutEggRequest{SecretID: "API_KEY", Plaintext: "super-secret-value"}); err != nil {
+		t.Fatalf("PutEgg: %v", err)
+	}
+	if _, err := store.GetEggByKey(ctx, "user-1", "API_KEY"); err != nil {
+		t.Fatalf("GetEggByKey: %v", err)
+	}
+	cfg := srv.Config()
+	if _, err := auth.RefreshAccessToken(ctx, client, cfg.GetTokenURL(), cfg.CognitoConfig.ClientID, tokens.RefreshToken); err != nil {
+		t.Fatalf("RefreshAccessToken: %v", err)
+	}
+
+	out := trace.String()
+	for _, secret := range []string{"super-secret-value", tokens.AccessToken, tokens.RefreshToken, "eyJ"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("trace leaks %q:\n%s", secret, out)
+		}
+	}
+	for _, want := range []string{"--> POST " + srv.URL + "/eggs", "<-- 201 Created POST", "Authorization: Bearer [REDACTED]", `"secret_id":"API_KEY"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("trace is missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestVaultCache(t *testing.T) {
+	srv := eggtest.NewServer(t)
+	srv.Seed("user-1", "API_KEY", "value-1")
+	srv.Seed("user-1", "DB_URL", "db-1")
+	tokens := srv.IssueTokens("user-1")
+	ctx := context.Background()
+
+	key, err := cache.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := cache.Options{Path: filepath.Join(t.TempDir(), "vault.json"), Owner: "user-1", Key: key, TTL: time.Hour}
+	get := func(store api.Store) string {
+		t.Helper()
+		egg, err := store.GetEggByKey(ctx, "user-1", "API_KEY")
+		if err != nil {
+			t.Fatalf("GetEggByKey: %v", err)
+		}
+		return egg.Plaintext
+	}
+
+	// Without a local copy, a keyed read fetches just that secret
+	client := api.NewClient(srv.URL, tokens.AccessToken)
+	if got := get(cache.New(client, opts)); got != "value-1" {
+		t.Fatalf("first read = %q", got)
+	}
+	if _, err := os.Stat(opts.Path); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("a keyed read downloaded the vault: %v", err)
+	}
+
+	eggs, err := cache.New(client, opts).GetEggsByKeys(ctx, "user-1", []string{"DB_URL", "API_KEY"})
+	if err != nil || len(eggs) != 2 || eggs[0].Plaintext != "db-1" || eggs[1].Plaintext != "value-1" {
+		t.Fatalf("GetEggsByKeys = %+v, %v", eggs, err)
+	}
+	if _, err := cache.New(client, opts).GetEggsByKeys(ctx, "user-1", []string{"API_KEY", "MISSING"}); !errors.Is(err, api.ErrNotFound) {
+		t.Fatalf("GetEggsByKeys with a missing key = %v, want ErrNotFound", err)
+	}
+	if _, err := os.Stat(opts.Path); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("a keyed read downloaded the vault: %v", err)
+	}
+
+	// Syncing fills the cache; later processes are served from disk
+	if _, err := cache.New(client, opts).Refresh(ctx); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	before := srv.Requests()
+	if got := get(cache.New(client, opts)); got != "value-1" || srv.Requests() != before {
+		t.Fatalf("cached read = %q after %d request(s)", got, srv.Requests()-before)
+	}
+	if data, err := os.ReadFile(opts.Path); err != nil || bytes.Contains(data, []byte("value-1")) {
+		t.Fatalf("cache file is missing or unencrypted: %v", err)
+	}
+
+	// Past the TTL a keyed read asks for that secret again, with one request
+	opts.TTL = time.Nanosecond
+	before = srv.Requests()
+	if got := get(cache.New(client, opts)); got != "value-1" || srv.Requests() != before+1 {
+		t.Fatalf("read past the TTL = %q after %d request(s)", got, srv.Requests()-before)
+	}
+	srv.Seed("user-1", "API_KEY", "value-2")
+	if got := get(cache.New(client, opts)); got != "value-2" {
+		t.Fatalf("read after change = %q, want value-2", got)
+	}
+
+	// A new login's key cannot read the old cache
+	opts.TTL = time.Hour
+	if opts.Key, err = cache.NewKey(); err != nil {
+		t.Fatal(err)
+	}
+	before = srv.Requests()
+	if get(cache.New(client, opts)); srv.Requests() == before {
+		t.Fatal("a cache encrypted with another key was used")
+	}
+}
+
+func TestOfflineReads(t *testing.T) {
+	srv := eggtest.NewServer(t)
+	srv.Seed("user-1", "API_KEY", "value-1")
+	tokens := srv.IssueTokens("user-1")
+	ctx := context.Background()
+
+	key, err := cache.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var causes []error
+	opts := cache.Options{
+		Path:      filepath.Join(t.TempDir(), "vault.json"),
+		Owner:     "user-1",
+		Key:       key,
+		TTL:       time.Nanosecond,
+		OnOffline: func(_ time.Time, cause error) { causes = append(causes, cause) },
+	}
+	client := api.NewClient(srv.URL, tokens.AccessToken)
+
+	// --offline without a local copy has nothing to serve
+	offline := opts
+	offline.Offline = true
+	if _, err := cache.New(client, offline).GetEggByKey(ctx, "user-1", "API_KEY"); !errors.Is(err, cache.ErrNoSnapshot) {
+		t.Fatalf("offline read without a copy: %v, want ErrNoSnapshot", err)
+	}
+
+	// While the API is down, reads fall back to the last copy with one warning
+	if _, err := cache.New(client, opts).Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	srv.FailNext(1000, http.StatusServiceUnavailable)
+	store := cache.New(client, opts)
+	for range 2 {
+		egg, err := store.GetEggByKey(ctx, "user-1", "API_KEY")
+		if err != nil || egg.Plaintext != "value-1" {
+			t.Fatalf("fallback read = %v, %v", egg, err)
+		}
+	}
+	if len(causes) != 1 || !errors.Is(causes[0], api.ErrServer) {
+		t.Fatalf("OnOffline causes = %v, want one ErrServer", causes)
+	}
+	if _, err := store.GetEggByKey(ctx, "user-1", "MISSING"); !errors.Is(err, api.ErrNotFound) {
+		t.Fatalf("offline miss: %v, want ErrNotFound", err)
+	}
+	if err := store.PutEgg(ctx, "user-1", api.PutEggRequest{SecretID: "API_KEY", Plaintext: "value-2"}); !errors.Is(err, cache.ErrOffline) {
+		t.Fatalf("offline write: %v, want ErrOffline", err)
+	}
+
+	// A copy older than the max staleness is refused
+	opts.MaxStaleness = time.Nanosecond
+	if _, err := cache.New(client, opts).GetEggByKey(ctx, "user-1", "API_KEY"); !errors.Is(err, cache.ErrTooStale) || !errors.Is(err, api.ErrServer) {
+		t.Fatalf("stale read: %v, want ErrTooStale and the cause", err)
+	}
 }
 
-// Example of how to test the full flow
 func TestFullLoginFlow(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping integration test")
 	}
 
-	// TODO: This would be a full integration test
-	// 1. Generate PKCE
-	// 2. Build auth URL
-	// 3. Mock the callback (don't actually open browser)
-	// 4. Exchange code for tokens
-	// 5. Save tokens
-	// 6. Verify tokens are saved
+	srv := eggtest.NewServer(t)
+	cfg := newFakeConfig(t, srv)
+	ctx := context.Background()
+
+	// 1. Generate PKCE and build the authorization URL
+	pkce, err := auth.GeneratePKCEChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL := auth.BuildAuthorizationURL(cfg.GetAuthorizationURL(), cfg.CognitoConfig.ClientID, cfg.GetRedirectURI(), pkce.Challenge)
+
+	// 2. Play the browser: the fake logs in at once and redirects with a code
+	browser := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := browser.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || callback.Query().Get("code") == "" {
+		t.Fatalf("authorize redirected to %q, want a code", resp.Header.Get("Location"))
+	}
+
+	// 3. Exchange the code; it is single use
+	code := callback.Query().Get("code")
+	tokens, err := auth.ExchangeCodeForTokens(ctx, nil, cfg.GetTokenURL(), cfg.CognitoConfig.ClientID, code, cfg.GetRedirectURI(), pkce.Verifier)
+	if err != nil {
+		t.Fatalf("ExchangeCodeForTokens: %v", err)
+	}
+	if _, err := auth.ExchangeCodeForTokens(ctx, nil, cfg.GetTokenURL(), cfg.CognitoConfig.ClientID, code, cfg.GetRedirectURI(), pkce.Verifier); !errors.Is(err, auth.ErrTokenRejected) {
+		t.Fatalf("reused code error = %v, want ErrTokenRejected", err)
+	}
+
+	// 4. Save the tokens and read the owner back
+	if err := cfg.SaveTokens(tokens); err != nil {
+		t.Fatalf("SaveTokens: %v", err)
+	}
+	if owner, err := cfg.GetOwner(); err != nil || owner != eggtest.DefaultUser {
+		t.Fatalf("GetOwner = %q, %v, want %q", owner, err, eggtest.DefaultUser)
+	}
+
+	// 5. Refreshing keeps the refresh token, which Cognito does not rotate
+	refreshed, err := auth.RefreshAccessToken(ctx, nil, cfg.GetTokenURL(), cfg.CognitoConfig.ClientID, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshAccessToken: %v", err)
+	}
+	if refreshed.RefreshToken != tokens.RefreshToken || refreshed.AccessToken == "" {
+		t.Fatalf("refreshed tokens = %+v", refreshed)
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	srv := eggtest.NewServer(t)
+	cfg := newFakeConfig(t, srv)
+	egg := newEggRunner(commands.DoctorCmd)
+	doctor := func() (map[string]string, string, error) {
+		t.Helper()
+		out, err := captureStdout(t, func() error { return egg("doctor", "--json") })
+		var report struct {
+			Checks []struct{ Name, Status, Message string }
+		}
+		if jsonErr := json.Unmarshal([]byte(out), &report); jsonErr != nil {
+			t.Fatalf("doctor --json printed %q: %v", out, jsonErr)
+		}
+		statuses := map[string]string{}
+		for _, check := range report.Checks {
+			statuses[check.Name] = check.Status + ": " + check.Message
+		}
+		return statuses, out, err
+	}
+
+	// An expired session with a refresh token is reported, not refreshed,
+	// so whether the refresh token still works is unknown
+	tokens := srv.IssueTokens("user-1")
+	tokens.IssuedAt = time.Now().Add(-2 * time.Hour).Unix()
+	if err := cfg.SaveTokens(tokens); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Dir(cfg.TokenPath), 0700); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(cfg.TokenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks, out, _ := doctor()
+	if !strings.HasPrefix(checks["config"], "pass") || !strings.HasPrefix(checks["credentials"], "pass") {
+		t.Fatalf("doctor checks = %v, want config and credentials to pass", checks)
+	}
+	if token := checks["token"]; !strings.HasPrefix(token, "warn") || !strings.Contains(token, "not verified") {
+		t.Fatalf("token check = %q, want a warning that the refresh token is not verified", token)
+	}
+	if after, err := os.ReadFile(cfg.TokenPath); err != nil || !bytes.Equal(after, before) {
+		t.Fatalf("doctor changed the credentials file: %v", err)
+	}
+	if strings.Contains(out, tokens.AccessToken) || strings.Contains(out, tokens.RefreshToken) {
+		t.Fatal("the doctor report contains a token")
+	}
+
+	// Without a refresh token the session is beyond repair
+	tokens.RefreshToken = ""
+	if err := cfg.SaveTokens(tokens); err != nil {
+		t.Fatal(err)
+	}
+	checks, _, err = doctor()
+	if token := checks["token"]; !strings.HasPrefix(token, "fail") || err == nil {
+		t.Fatalf("token check without a refresh token = %q (%v), want a failure", token, err)
+	}
+
+	// --timeout cuts the network checks short
+	if _, err := captureStdout(t, func() error { return egg("--timeout", "1ns", "doctor") }); commands.ExitCode(err) != commands.ExitNetwork {
+		t.Fatalf("doctor --timeout 1ns = %v, want exit %d", err, commands.ExitNetwork)
+	}
+
+	// Loose permissions on the credentials file are flagged
+	if runtime.GOOS != "windows" {
+		if err := os.Chmod(cfg.TokenPath, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if checks, _, _ := doctor(); !strings.HasPrefix(checks["credentials"], "fail") {
+			t.Fatalf("credentials check with 0644 = %q, want a failure", checks["credentials"])
+		}
+	}
+}
+
+func TestLayAndHatch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("hatch test needs a POSIX shell")
+	}
+
+	srv := eggtest.NewServer(t)
+	cfg := newFakeConfig(t, srv)
+	if err := cfg.SaveTokens(srv.IssueTokens("user-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	egg := newEggRunner(commands.AddCmd, commands.RunCmd, commands.GetCmd)
+
+	// A cold start on the first attempt is retried transparently
+	srv.FailNext(1, http.StatusServiceUnavailable)
+	if err := egg("lay", "API_KEY", "abc123"); err != nil {
+		t.Fatalf("lay: %v", err)
+	}
+	if value, ok := srv.Secret("user-1", "API_KEY"); !ok || value != "abc123" {
+		t.Fatalf("stored secret = %q, %v", value, ok)
+	}
 
-	t.Skip("Implement this as an integration test")
+	out := filepath.Join(t.TempDir(), "out")
+	if err := egg("hatch", "--", sh, "-c", `printf %s "$API_KEY" > "$1"`, "sh", out); err != nil {
+		t.Fatalf("hatch: %v", err)
+	}
+	if got, err := os.ReadFile(out); err != nil || string(got) != "abc123" {
+		t.Fatalf("child saw API_KEY = %q, %v", got, err)
+	}
+
+	// Refreshing an expired session says so on stderr, keeping it out of
+	// piped output
+	tokens := srv.IssueTokens("user-1")
+	tokens.IssuedAt = time.Now().Add(-2 * time.Hour).Unix()
+	if err := cfg.SaveTokens(tokens); err != nil {
+		t.Fatal(err)
+	}
+	var piped string
+	stderr, err := captureStderr(t, func() error {
+		var err error
+		piped, err = captureStdout(t, func() error { return egg("hatch", "--", sh, "-c", `printf %s "$API_KEY"`) })
+		return err
+	})
+	if err != nil || !strings.HasSuffix(piped, "abc123") || strings.Contains(piped, "Token expired") || !strings.Contains(stderr, "Token expired") {
+		t.Fatalf("hatch with an expired session printed %q and %q on stderr, %v; want the refresh notice on stderr only", piped, stderr, err)
+	}
+
+	// Picking keys fetches just those secrets, not the whole vault
+	for _, key := range []string{"A", "B", "C", "D"} {
+		srv.Seed("user-1", key, strings.ToLower(key))
+	}
+	cachePath, err := cache.Path(cfg.Profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(cachePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal(err)
+	}
+	before := srv.Requests()
+	if err := egg("hatch", "-k", "API_KEY,B", "--", sh, "-c", `printf %s "$API_KEY:$B:${A-unset}" > "$1"`, "sh", out); err != nil {
+		t.Fatalf("hatch -k: %v", err)
+	}
+	if got, err := os.ReadFile(out); err != nil || string(got) != "abc123:b:unset" {
+		t.Fatalf("child of hatch -k saw %q, %v", got, err)
+	}
+	if n := srv.Requests() - before; n != 2 {
+		t.Fatalf("hatch -k for 2 secrets made %d request(s), want 2", n)
+	}
+	stdout, err := captureStdout(t, func() error { return egg("get", "C") })
+	if err != nil || !strings.Contains(stdout, "Value: c") {
+		t.Fatalf("get C = %q, %v", stdout, err)
+	}
+	if err := egg("hatch", "-k", "MISSING", "--", sh, "-c", "true"); commands.ExitCode(err) != commands.ExitNotFound {
+		t.Fatalf("hatch -k MISSING = %v, want exit %d", err, commands.ExitNotFound)
+	}
+
+	// Keys that differ only in case can't both become API_KEY
+	if err := egg("lay", "api_key", "lower"); err != nil {
+		t.Fatalf("lay api_key: %v", err)
+	}
+	if err := egg("hatch", "--", sh, "-c", "true"); err == nil || !strings.Contains(err.Error(), "API_KEY and api_key") {
+		t.Fatalf("hatch with clashing keys = %v, want an error naming both", err)
+	}
+	if err := egg("hatch", "-k", "api_key", "--", sh, "-c", `printf %s "$API_KEY" > "$1"`, "sh", out); err != nil {
+		t.Fatalf("hatch -k api_key: %v", err)
+	}
+	if got, err := os.ReadFile(out); err != nil || string(got) != "lower" {
+		t.Fatalf("child of hatch -k api_key saw API_KEY = %q, %v", got, err)
+	}
+
+	// Throttling that outlasts the retries surfaces as a typed error
+	srv.FailNext(3, http.StatusTooManyRequests)
+	if err := egg("lay", "API_KEY", "def456"); commands.ExitCode(err) != commands.ExitRateLimited {
+		t.Fatalf("lay while throttled = %v, want exit %d", err, commands.ExitRateLimited)
+	}
+}
+
+// racyStore calls before ahead of every write, as if a teammate wrote the
+// same secret just then
+type racyStore struct {
+	*api.Client
+	before func(secretID string)
+}
+
+func (r racyStore) PutEgg(ctx context.Context, owner string, req api.PutEggRequest) error {
+	r.before(req.SecretID)
+	return r.Client.PutEgg(ctx, owner, req)
+}
+
+func (r racyStore) PutEggIfMatch(ctx context.Context, owner string, req api.PutEggRequest, ifMatch api.Precondition) error {
+	r.before(req.SecretID)
+	return r.Client.PutEggIfMatch(ctx, owner, req, ifMatch)
+}
+
+func (r racyStore) BreakEgg(ctx context.Context, owner, secretID string) error {
+	r.before(secretID)
+	return r.Client.BreakEgg(ctx, owner, secretID)
+}
+
+func (r racyStore) BreakEggIfMatch(ctx context.Context, owner, secretID string, ifMatch api.Precondition) error {
+	r.before(secretID)
+	return r.Client.BreakEggIfMatch(ctx, owner, secretID, ifMatch)
+}
+
+// memoryStore is a backend with none of the optional capabilities, as a
+// third-party one might start out
+type memoryStore struct {
+	mu   sync.Mutex
+	eggs map[string]string // secret ID -> value
+}
+
+func (m *memoryStore) PutEgg(ctx context.Context, owner string, req api.PutEggRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.eggs[req.SecretID] = req.Plaintext
+	return nil
+}
+
+func (m *memoryStore) GetEggByKey(ctx context.Context, owner, secretID string) (*api.GetEggResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.eggs[secretID]
+	if !ok {
+		return nil, fmt.Errorf("secret %q: %w", secretID, api.ErrNotFound)
+	}
+	return &api.GetEggResponse{Owner: owner, SecretID: secretID, Plaintext: value}, nil
+}
+
+func (m *memoryStore) GetEggsByKeys(ctx context.Context, owner string, secretIDs []string) ([]api.GetEggResponse, error) {
+	eggs := make([]api.GetEggResponse, len(secretIDs))
+	for i, id := range secretIDs {
+		egg, err := m.GetEggByKey(ctx, owner, id)
+		if err != nil {
+			return nil, err
+		}
+		eggs[i] = *egg
+	}
+	return eggs, nil
+}
+
+func (m *memoryStore) AllEggs(ctx context.Context, owner string) iter.Seq2[api.GetEggResponse, error] {
+	return func(yield func(api.GetEggResponse, error) bool) {
+		m.mu.Lock()
+		keys := slices.Sorted(maps.Keys(m.eggs))
+		m.mu.Unlock()
+		for _, key := range keys {
+			egg, err := m.GetEggByKey(ctx, owner, key)
+			if err != nil || !yield(*egg, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (m *memoryStore) AllEggMetadata(ctx context.Context, owner string) iter.Seq2[api.EggMetadata, error] {
+	return func(yield func(api.EggMetadata, error) bool) {
+		for egg := range m.AllEggs(ctx, owner) {
+			if !yield(api.EggMetadata{SecretID: egg.SecretID, Size: len(egg.Plaintext)}, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (m *memoryStore) GetEggMetadata(ctx context.Context, owner, secretID string) (*api.EggMetadata, error) {
+	egg, err := m.GetEggByKey(ctx, owner, secretID)
+	if err != nil {
+		return nil, err
+	}
+	return &api.EggMetadata{SecretID: secretID, Size: len(egg.Plaintext)}, nil
+}
+
+func (m *memoryStore) BreakEgg(ctx context.Context, owner, secretID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.eggs[secretID]; !ok {
+		return fmt.Errorf("secret %q: %w", secretID, api.ErrNotFound)
+	}
+	delete(m.eggs, secretID)
+	return nil
+}
+
+// memoryBackend is registered once as the "memory" backend; the options it
+// was last opened with are kept for inspection
+var (
+	memoryBackend     = &memoryStore{eggs: map[string]string{}}
+	memoryBackendOpts api.BackendOptions
+	registerMemory    sync.Once
+)
+
+func TestPluggableBackend(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+	registerMemory.Do(func() {
+		api.RegisterBackend("memory", func(opts api.BackendOptions) (api.Store, error) {
+			memoryBackendOpts = opts
+			return memoryBackend, nil
+		})
+	})
+	if !slices.Contains(api.Backends(), "memory") {
+		t.Fatalf("Backends() = %v, want memory listed", api.Backends())
+	}
+	if _, err := api.OpenStore("nosuch", api.BackendOptions{}); err == nil || !strings.Contains(err.Error(), "memory") {
+		t.Fatalf("OpenStore of an unknown backend = %v, want the available ones listed", err)
+	}
+
+	// The profile selects the backend and passes it its settings
+	srv := eggtest.NewServer(t)
+	cfg := newFakeConfig(t, srv)
+	if err := cfg.SaveTokens(srv.IssueTokens("user-1")); err != nil {
+		t.Fatal(err)
+	}
+	file, err := config.ReadConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Profiles[cfg.Profile] = &config.Config{Backend: "memory", BackendSettings: map[string]string{"vault": "team-a"}}
+	if err := file.Save(); err != nil {
+		t.Fatal(err)
+	}
+	egg := newEggRunner(commands.AddCmd, commands.GetCmd, commands.BreakCmd, commands.HistoryCmd)
+
+	if err := egg("lay", "API_KEY", "from-memory"); err != nil {
+		t.Fatalf("lay: %v", err)
+	}
+	if memoryBackend.eggs["API_KEY"] != "from-memory" || memoryBackendOpts.Settings["vault"] != "team-a" {
+		t.Fatalf("memory backend holds %v, opened with %+v", memoryBackend.eggs, memoryBackendOpts)
+	}
+	if _, ok := srv.Secret("user-1", "API_KEY"); ok {
+		t.Fatal("lay reached the HTTP API instead of the configured backend")
+	}
+	out, err := captureStdout(t, func() error { return egg("get", "API_KEY") })
+	if err != nil || !strings.Contains(out, "Value: from-memory") {
+		t.Fatalf("get = %q, %v", out, err)
+	}
+
+	// Optional capabilities the backend lacks are reported, not faked
+	if err := egg("history", "API_KEY"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("history on a backend without it = %v, want ErrUnsupported", err)
+	}
+	if err := egg("break", "--yes", "API_KEY"); err != nil {
+		t.Fatalf("break: %v", err)
+	}
+	if _, ok := memoryBackend.eggs["API_KEY"]; ok {
+		t.Fatal("break did not reach the configured backend")
+	}
+}
+
+func TestExitCodesAndCancellation(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("exit code test needs the go tool to build egg")
+	}
+
+	// Build the real binary, since main maps errors to exit codes
+	bin := filepath.Join(t.TempDir(), "egg")
+	if out, err := exec.Command(goTool, "build", "-o", bin, ".").CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+
+	srv := eggtest.NewServer(t)
+	cfg := newFakeConfig(t, srv)
+	if err := cfg.SaveTokens(srv.IssueTokens("user-1")); err != nil {
+		t.Fatal(err)
+	}
+	srv.Seed("user-1", "API_KEY", "value")
+	egg := func(args ...string) (*exec.Cmd, *bytes.Buffer) {
+		cmd := exec.Command(bin, append([]string{"--no-cache", "--retries", "0"}, args...)...)
+		stderr := &bytes.Buffer{}
+		cmd.Stderr = stderr
+		return cmd, stderr
+	}
+	exitCode := func(err error) int {
+		t.Helper()
+		var exitErr *exec.ExitError
+		if err != nil && !errors.As(err, &exitErr) {
+			t.Fatal(err)
+		}
+		if exitErr == nil {
+			return 0
+		}
+		return exitErr.ExitCode()
+	}
+
+	// Usage mistakes print the usage; failures of a valid command don't
+	cmd, stderr := egg("get", "--no-such-flag")
+	if code := exitCode(cmd.Run()); code == 0 || !strings.Contains(stderr.String(), "Usage:") {
+		t.Fatalf("unknown flag exited %d with %q, want a failure and the usage", code, stderr)
+	}
+	cmd, stderr = egg("get", "MISSING")
+	if code := exitCode(cmd.Run()); code != commands.ExitNotFound || strings.Contains(stderr.String(), "Usage:") {
+		t.Fatalf("get MISSING exited %d with %q, want %d and no usage", code, stderr, commands.ExitNotFound)
+	}
+
+	// --timeout bounds a slow server
+	srv.SetLatency(10 * time.Second)
+	cmd, stderr = egg("--timeout", "200ms", "get", "API_KEY")
+	start := time.Now()
+	if code := exitCode(cmd.Run()); code != commands.ExitNetwork || !strings.Contains(stderr.String(), "timed out") {
+		t.Fatalf("get with --timeout exited %d with %q, want %d", code, stderr, commands.ExitNetwork)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("get with --timeout 200ms took %s", elapsed)
+	}
+
+	// Ctrl-C cancels the request in flight and exits 130
+	if runtime.GOOS == "windows" {
+		return
+	}
+	cmd, stderr = egg("get", "API_KEY")
+	before := srv.Requests()
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); srv.Requests() == before; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			cmd.Process.Kill()
+			t.Fatal("egg get never reached the server")
+		}
+	}
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+	if code := exitCode(cmd.Wait()); code != commands.ExitInterrupted || !strings.Contains(stderr.String(), "interrupted") {
+		t.Fatalf("interrupted get exited %d with %q, want %d", code, stderr, commands.ExitInterrupted)
+	}
+}
+
+func TestOfflineQueueAndSync(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	srv := eggtest.NewServer(t)
+	cfg := newFakeConfig(t, srv)
+	if err := cfg.SaveTokens(srv.IssueTokens("user-1")); err != nil {
+		t.Fatal(err)
+	}
+	srv.Seed("user-1", "API_KEY", "old")
+	srv.Seed("user-1", "DB_URL", "old")
+
+	egg := newEggRunner(commands.AddCmd, commands.BreakCmd, commands.SyncCmd, commands.StatusCmd, commands.GetCmd)
+
+	// Writes made offline are queued against the synced copy
+	if err := egg("sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	for _, args := range [][]string{
+		{"--offline", "lay", "API_KEY", "new"},
+		{"--offline", "break", "--yes", "DB_URL"},
+		{"--offline", "lay", "TOKEN", "t1"},
+		{"--offline", "status"},
+	} {
+		if err := egg(args...); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+	}
+	if value, _ := srv.Secret("user-1", "API_KEY"); value != "old" {
+		t.Fatalf("offline lay reached the server: API_KEY = %q", value)
+	}
+	out, err := captureStdout(t, func() error { return egg("--offline", "get", "API_KEY") })
+	if err != nil || !strings.Contains(out, "Value: new") {
+		t.Fatalf("offline get after offline lay = %q, %v; want the queued value", out, err)
+	}
+
+	// A secret changed on the server meanwhile is a conflict and stays queued
+	srv.Seed("user-1", "DB_URL", "changed")
+	if err := egg("sync", "--push"); commands.ExitCode(err) != commands.ExitConflict {
+		t.Fatalf("push with a conflict = %v, want exit %d", err, commands.ExitConflict)
+	}
+	if value, _ := srv.Secret("user-1", "API_KEY"); value != "new" {
+		t.Fatalf("API_KEY = %q after push, want new", value)
+	}
+	if value, _ := srv.Secret("user-1", "TOKEN"); value != "t1" {
+		t.Fatalf("TOKEN = %q after push, want t1", value)
+	}
+	if _, ok := srv.Secret("user-1", "DB_URL"); !ok {
+		t.Fatal("a conflicting break was applied")
+	}
+
+	if err := egg("sync", "--push", "--force"); err != nil {
+		t.Fatalf("forced push: %v", err)
+	}
+	if _, ok := srv.Secret("user-1", "DB_URL"); ok {
+		t.Fatal("forced break was not applied")
+	}
+
+	// A write queued right after an online one is made against it
+	if err := egg("lay", "API_KEY", "online"); err != nil {
+		t.Fatalf("lay: %v", err)
+	}
+	if err := egg("--offline", "lay", "API_KEY", "offline"); err != nil {
+		t.Fatalf("offline lay: %v", err)
+	}
+	if err := egg("sync", "--push"); err != nil {
+		t.Fatalf("push after an online write = %v, want no conflict", err)
+	}
+	if value, _ := srv.Secret("user-1", "API_KEY"); value != "offline" {
+		t.Fatalf("API_KEY = %q after push, want offline", value)
+	}
+
+	// A push whose response was lost is replayed, not reported as a
+	// conflict with itself
+	if err := egg("--offline", "lay", "API_KEY", "lost"); err != nil {
+		t.Fatalf("offline lay: %v", err)
+	}
+	srv.LoseNext(1, http.StatusInternalServerError)
+	if err := egg("sync", "--push"); err == nil {
+		t.Fatal("push with a lost response succeeded")
+	}
+	if value, _ := srv.Secret("user-1", "API_KEY"); value != "lost" {
+		t.Fatalf("API_KEY = %q after a lost response, want lost", value)
+	}
+	if err := egg("sync", "--push"); err != nil {
+		t.Fatalf("push after a lost response = %v, want no conflict", err)
+	}
+
+	// A teammate's write landing between the conflict check and the queued
+	// write is not overwritten, for a new secret or a deleted one
+	client := api.NewClient(srv.URL, srv.IssueTokens("user-1").AccessToken)
+	meta, err := client.GetEggMetadata(context.Background(), "user-1", "API_KEY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	racy := cache.OpenOutbox(filepath.Join(t.TempDir(), "outbox.json"), "user-1", make([]byte, cache.KeySize))
+	if err := racy.Add(cache.Op{Kind: cache.OpPut, SecretID: "NEW_KEY", Plaintext: "ours"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := racy.Add(cache.Op{Kind: cache.OpDelete, SecretID: "API_KEY", Base: meta.Revision()}); err != nil {
+		t.Fatal(err)
+	}
+	teammate := racyStore{Client: client, before: func(secretID string) {
+		srv.Seed("user-1", secretID, "theirs")
+	}}
+	results, err := racy.Push(context.Background(), teammate, false)
+	if err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	for _, result := range results {
+		if !errors.Is(result.Err, api.ErrConflict) {
+			t.Errorf("push of %s %s = %v, want a conflict", result.Op.Kind, result.Op.SecretID, result.Err)
+		}
+	}
+	for _, key := range []string{"NEW_KEY", "API_KEY"} {
+		if value, _ := srv.Secret("user-1", key); value != "theirs" {
+			t.Errorf("%s = %q after a racing push, want the teammate's write kept", key, value)
+		}
+	}
+
+	// A lay that reached the server but got a server error back is queued
+	// under the Idempotency-Key it was sent with, so pushing it doesn't
+	// write it again
+	srv.LoseNext(3, http.StatusServiceUnavailable)
+	if err := egg("lay", "API_KEY", "flaky"); err != nil {
+		t.Fatalf("lay answered with server errors = %v, want it queued", err)
+	}
+	written, err := client.GetEggMetadata(context.Background(), "user-1", "API_KEY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := egg("sync", "--push"); err != nil {
+		t.Fatalf("push of a lay that reached the server = %v, want no conflict", err)
+	}
+	if meta, err := client.GetEggMetadata(context.Background(), "user-1", "API_KEY"); err != nil || meta.Version != written.Version {
+		t.Fatalf("API_KEY after push = %+v, %v; want version %d, written once", meta, err, written.Version)
+	}
+
+	// Concurrent runs don't drop each other's queued writes
+	outbox := cache.OpenOutbox(filepath.Join(t.TempDir(), "outbox.json"), "user-1", make([]byte, cache.KeySize))
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := outbox.Add(cache.Op{Kind: cache.OpPut, SecretID: fmt.Sprintf("KEY_%d", i)}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if ops, err := outbox.Pending(); err != nil || len(ops) != 10 {
+		t.Fatalf("outbox holds %d write(s) after 10 concurrent adds, %v", len(ops), err)
+	}
+}
+
+func TestBatchLayAndBreak(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	srv := eggtest.NewServer(t)
+	cfg := newFakeConfig(t, srv)
+	if err := cfg.SaveTokens(srv.IssueTokens("user-1")); err != nil {
+		t.Fatal(err)
+	}
+	egg := newEggRunner(commands.AddCmd, commands.BreakCmd)
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("# comment\nDB_URL=\"postgres://db/app?a=b\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := egg("lay", "API_KEY=abc", "TOKEN=x=y", "--from-file", envFile); err != nil {
+		t.Fatalf("batch lay: %v", err)
+	}
+	for key, want := range map[string]string{"API_KEY": "abc", "TOKEN": "x=y", "DB_URL": "postgres://db/app?a=b"} {
+		if got, _ := srv.Secret("user-1", key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+
+	// Bulk deletes need confirmation, which can't be asked for here
+	if err := egg("break", "API_KEY", "TOKEN"); err == nil {
+		t.Fatal("bulk break without --yes succeeded")
+	}
+	if _, ok := srv.Secret("user-1", "API_KEY"); !ok {
+		t.Fatal("unconfirmed bulk break deleted API_KEY")
+	}
+
+	// One missing key fails the batch without stopping the others
+	err := egg("break", "--yes", "API_KEY", "MISSING", "TOKEN")
+	if commands.ExitCode(err) != commands.ExitNotFound {
+		t.Fatalf("batch break = %v, want exit %d", err, commands.ExitNotFound)
+	}
+	for _, key := range []string{"API_KEY", "TOKEN"} {
+		if _, ok := srv.Secret("user-1", key); ok {
+			t.Errorf("%s was not deleted", key)
+		}
+	}
+}
+
+func TestOptimisticConcurrency(t *testing.T) {
+	srv := eggtest.NewServer(t)
+	srv.Seed("user-1", "API_KEY", "v1")
+	client := api.NewClient(srv.URL, srv.IssueTokens("user-1").AccessToken)
+	ctx := context.Background()
+
+	egg, err := client.GetEggByKey(ctx, "user-1", "API_KEY")
+	if err != nil || egg.Version != 1 {
+		t.Fatalf("GetEggByKey = %+v, %v; want version 1", egg, err)
+	}
+	read := api.Precondition{Version: egg.Version, UpdatedAt: egg.UpdatedAt}
+	if err := client.PutEggIfMatch(ctx, "user-1", api.PutEggRequest{SecretID: "API_KEY", Plaintext: "v2"}, read); err != nil {
+		t.Fatalf("write at the current version: %v", err)
+	}
+
+	// A second writer holding the old version gets a conflict with both sides
+	err = client.PutEggIfMatch(ctx, "user-1", api.PutEggRequest{SecretID: "API_KEY", Plaintext: "v3"}, read)
+	var conflict *api.ConflictError
+	if !errors.As(err, &conflict) || !errors.Is(err, api.ErrConflict) {
+		t.Fatalf("stale write = %v, want a ConflictError", err)
+	}
+	if conflict.CurrentVersion != 2 || conflict.CurrentUpdatedAt == "" ||
+		!strings.Contains(err.Error(), read.UpdatedAt) || !strings.Contains(err.Error(), conflict.CurrentUpdatedAt) {
+		t.Fatalf("conflict = %+v (%v), want version 2 and both timestamps", conflict, err)
+	}
+	if value, _ := srv.Secret("user-1", "API_KEY"); value != "v2" {
+		t.Fatalf("API_KEY = %q after a rejected write", value)
+	}
+
+	// A conflict that doesn't describe the server's copy says so
+	srv.FailNext(1, http.StatusPreconditionFailed)
+	err = client.PutEggIfMatch(ctx, "user-1", api.PutEggRequest{SecretID: "API_KEY", Plaintext: "v3"}, api.Precondition{Version: 2})
+	if !errors.Is(err, api.ErrConflict) || !strings.Contains(err.Error(), "now: unknown") {
+		t.Fatalf("conflict without the current copy = %v, want \"now: unknown\"", err)
+	}
+
+	// Version 0 only creates
+	if err := client.PutEggIfMatch(ctx, "user-1", api.PutEggRequest{SecretID: "NEW_KEY", Plaintext: "x"}, api.Precondition{}); err != nil {
+		t.Fatalf("create with version 0: %v", err)
+	}
+	if err := client.PutEggIfMatch(ctx, "user-1", api.PutEggRequest{SecretID: "NEW_KEY", Plaintext: "y"}, api.Precondition{}); !errors.Is(err, api.ErrConflict) {
+		t.Fatalf("second create with version 0 = %v, want a conflict", err)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("edit test needs a POSIX shell")
+	}
+
+	srv := eggtest.NewServer(t)
+	cfg := newFakeConfig(t, srv)
+	if err := cfg.SaveTokens(srv.IssueTokens("user-1")); err != nil {
+		t.Fatal(err)
+	}
+	srv.Seed("user-1", "API_KEY", "old")
+	egg := newEggRunner(commands.AddCmd, commands.EditCmd)
+
+	// The "editor" replaces the file, newline included like a real one
+	editor := filepath.Join(t.TempDir(), "editor.sh")
+	if err := os.WriteFile(editor, []byte("#!/bin/sh\nprintf 'new\\n' > \"$1\"\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VISUAL", "  ") // Blank, so EDITOR is used
+	t.Setenv("EDITOR", editor)
+
+	if err := egg("edit", "API_KEY"); err != nil {
+		t.Fatalf("edit: %v", err)
+	}
+	if value, _ := srv.Secret("user-1", "API_KEY"); value != "new" {
+		t.Fatalf("API_KEY = %q after edit, want new", value)
+	}
+
+	// lay --if-match with a stale version is a conflict, which says when
+	// both versions were written
+	err := egg("lay", "--if-match", "1", "API_KEY", "newer")
+	if commands.ExitCode(err) != commands.ExitConflict {
+		t.Fatalf("stale lay --if-match = %v, want exit %d", err, commands.ExitConflict)
+	}
+	if strings.Count(err.Error(), "updated ") != 2 {
+		t.Fatalf("stale lay --if-match = %v, want both timestamps", err)
+	}
+	if err := egg("lay", "--if-match", "2", "API_KEY", "newer"); err != nil {
+		t.Fatalf("lay --if-match at the current version: %v", err)
+	}
+}
+
+func TestHistoryAndRollback(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	srv := eggtest.NewServer(t, eggtest.WithPageSize(2))
+	cfg := newFakeConfig(t, srv)
+	if err := cfg.SaveTokens(srv.IssueTokens("user-1")); err != nil {
+		t.Fatal(err)
+	}
+	egg := newEggRunner(commands.AddCmd, commands.GetCmd, commands.HistoryCmd, commands.RollbackCmd)
+
+	for _, value := range []string{"one", "two", "three"} {
+		if err := egg("lay", "-m", "set to "+value, "API_KEY", value); err != nil {
+			t.Fatalf("lay %s: %v", value, err)
+		}
+	}
+	if err := egg("rollback", "API_KEY", "--to", "1"); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if value, _ := srv.Secret("user-1", "API_KEY"); value != "one" {
+		t.Fatalf("API_KEY = %q after rollback, want one", value)
+	}
+	if err := egg("history", "API_KEY", "--reveal"); err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if err := egg("get", "API_KEY", "--version", "9"); commands.ExitCode(err) != commands.ExitNotFound {
+		t.Fatalf("get --version 9 = %v, want exit %d", err, commands.ExitNotFound)
+	}
+
+	// History pages run newest first, with values only when asked for
+	client := api.NewClient(srv.URL, srv.IssueTokens("user-1").AccessToken)
+	var versions []api.EggVersion
+	for version, err := range client.EggHistory(context.Background(), "user-1", "API_KEY", false) {
+		if err != nil {
+			t.Fatalf("EggHistory: %v", err)
+		}
+		versions = append(versions, version)
+	}
+	if len(versions) != 4 || versions[0].Version != 4 || versions[3].Version != 1 {
+		t.Fatalf("history = %+v, want versions 4..1", versions)
+	}
+	if versions[0].Note != "rollback to version 1" || versions[1].Note != "set to three" ||
+		versions[0].Author != "user-1" || versions[0].Plaintext != "" {
+		t.Fatalf("history = %+v, want notes and authors without values", versions)
+	}
+
+	old, err := client.GetEggVersion(context.Background(), "user-1", "API_KEY", 2)
+	if err != nil || old.Plaintext != "two" || old.Version != 2 {
+		t.Fatalf("GetEggVersion(2) = %+v, %v; want two", old, err)
+	}
+}
+
+func TestTrashRestoreAndPurge(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	srv := eggtest.NewServer(t)
+	cfg := newFakeConfig(t, srv)
+	if err := cfg.SaveTokens(srv.IssueTokens("user-1")); err != nil {
+		t.Fatal(err)
+	}
+	srv.Seed("user-1", "API_KEY", "abc")
+	srv.Seed("user-1", "DB_URL", "postgres://db/app")
+	egg := newEggRunner(commands.BreakCmd, commands.TrashCmd, commands.RestoreCmd, commands.GetCmd)
+
+	// break is a soft delete that restore undoes, value and all
+	if err := egg("break", "API_KEY"); err != nil {
+		t.Fatalf("break: %v", err)
+	}
+	if _, ok := srv.Secret("user-1", "API_KEY"); ok || !srv.Trashed("user-1", "API_KEY") {
+		t.Fatal("break did not move API_KEY to the trash")
+	}
+	if err := egg("trash", "list"); err != nil {
+		t.Fatalf("trash list: %v", err)
+	}
+	if err := egg("get", "API_KEY"); commands.ExitCode(err) != commands.ExitNotFound {
+		t.Fatalf("get after break = %v, want exit %d", err, commands.ExitNotFound)
+	}
+	if err := egg("restore", "API_KEY"); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if value, _ := srv.Secret("user-1", "API_KEY"); value != "abc" || srv.Trashed("user-1", "API_KEY") {
+		t.Fatalf("API_KEY = %q after restore, want abc", value)
+	}
+	if err := egg("get", "API_KEY"); err != nil {
+		t.Fatalf("get after restore: %v", err)
+	}
+	if err := egg("restore", "API_KEY"); commands.ExitCode(err) != commands.ExitNotFound {
+		t.Fatalf("restore of a live secret = %v, want exit %d", err, commands.ExitNotFound)
+	}
+
+	// --purge needs confirmation and skips the trash
+	if err := egg("break", "--purge", "DB_URL"); err == nil {
+		t.Fatal("break --purge without --yes succeeded")
+	}
+	if err := egg("break", "--purge", "--yes", "DB_URL"); err != nil {
+		t.Fatalf("break --purge --yes: %v", err)
+	}
+	if _, ok := srv.Secret("user-1", "DB_URL"); ok || srv.Trashed("user-1", "DB_URL") {
+		t.Fatal("purged DB_URL is still stored")
+	}
+
+	// An API that doesn't report a trash gets asked about even one delete
+	hard := eggtest.NewServer(t, eggtest.WithTrashRetention(0))
+	hard.Seed("user-1", "OLD_TOKEN", "x")
+	cfg = newFakeConfig(t, hard)
+	if err := cfg.SaveTokens(hard.IssueTokens("user-1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := egg("break", "OLD_TOKEN"); err == nil {
+		t.Fatal("break without a trash and without --yes succeeded")
+	}
+	if _, ok := hard.Secret("user-1", "OLD_TOKEN"); !ok {
+		t.Fatal("unconfirmed break deleted OLD_TOKEN")
+	}
+	if err := egg("break", "--yes", "OLD_TOKEN"); err != nil {
+		t.Fatalf("break --yes without a trash: %v", err)
+	}
+}
+
+func TestSecretMetadata(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	srv := eggtest.NewServer(t)
+	cfg := newFakeConfig(t, srv)
+	if err := cfg.SaveTokens(srv.IssueTokens("user-1")); err != nil {
+		t.Fatal(err)
+	}
+	egg := newEggRunner(commands.AddCmd, commands.MetaCmd, commands.ListCmd, commands.SyncCmd, commands.GetCmd)
+
+	if err := egg("lay", "--description", "Webhook signing key", "--owner-team", "billing",
+		"--tag", "env=prod", "--tag", "tier=1", "LEGACY_TOKEN_2", "abc"); err != nil {
+		t.Fatalf("lay with metadata: %v", err)
+	}
+	if err := egg("lay", "--tag", "bad key=x", "OTHER", "x"); err == nil {
+		t.Fatal("lay with an invalid tag key succeeded")
+	}
+
+	// A later write without metadata flags keeps the metadata
+	if err := egg("lay", "LEGACY_TOKEN_2", "def"); err != nil {
+		t.Fatalf("lay: %v", err)
+	}
+	meta, _ := srv.Metadata("user-1", "LEGACY_TOKEN_2")
+	if meta.Description != "Webhook signing key" || meta.OwnerTeam != "billing" || meta.Tags["env"] != "prod" {
+		t.Fatalf("metadata = %+v after a plain lay", meta)
+	}
+
+	// meta set changes metadata only
+	if err := egg("meta", "set", "LEGACY_TOKEN_2", "--owner-team", "", "--tag", "env=staging", "--untag", "tier"); err != nil {
+		t.Fatalf("meta set: %v", err)
+	}
+	meta, _ = srv.Metadata("user-1", "LEGACY_TOKEN_2")
+	if meta.OwnerTeam != "" || meta.Tags["env"] != "staging" || meta.Tags["tier"] != "" || meta.Description == "" {
+		t.Fatalf("metadata = %+v after meta set", meta)
+	}
+	if value, _ := srv.Secret("user-1", "LEGACY_TOKEN_2"); value != "def" {
+		t.Fatalf("meta set changed the value to %q", value)
+	}
+	if err := egg("meta", "get", "LEGACY_TOKEN_2"); err != nil {
+		t.Fatalf("meta get: %v", err)
+	}
+	if err := egg("meta", "set", "MISSING", "--tag", "a=b"); commands.ExitCode(err) != commands.ExitNotFound {
+		t.Fatalf("meta set on a missing secret = %v, want exit %d", err, commands.ExitNotFound)
+	}
+
+	// Tag filters
+	store := api.NewClient(srv.URL, srv.IssueTokens("user-1").AccessToken)
+	srv.Seed("user-1", "UNTAGGED", "x")
+	for _, tc := range []struct {
+		filter map[string]string
+		want   []string
+	}{
+		{map[string]string{"env": "staging"}, []string{"LEGACY_TOKEN_2"}},
+		{map[string]string{"env": ""}, []string{"LEGACY_TOKEN_2"}},
+		{map[string]string{"env": "prod"}, nil},
+		{nil, []string{"LEGACY_TOKEN_2", "UNTAGGED"}},
+	} {
+		var got []string
+		for m, err := range store.AllEggMetadata(context.Background(), "user-1") {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.HasTags(tc.filter) {
+				got = append(got, m.SecretID)
+			}
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("filter %v = %v, want %v", tc.filter, got, tc.want)
+		}
+	}
+	if err := egg("list", "--tag", "env=staging"); err != nil {
+		t.Fatalf("list --tag: %v", err)
+	}
+
+	// Writes carry their metadata into the local copy, so offline tag
+	// filters find them, queued writes included
+	if err := egg("sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if err := egg("lay", "--tag", "env=prod", "NEW_KEY", "n"); err != nil {
+		t.Fatalf("lay --tag: %v", err)
+	}
+	if err := egg("--offline", "lay", "--tag", "team=web", "UNTAGGED", "y"); err != nil {
+		t.Fatalf("offline lay --tag: %v", err)
+	}
+	for tag, want := range map[string]string{"env=prod": "NEW_KEY", "team=web": "UNTAGGED"} {
+		out, err := captureStdout(t, func() error { return egg("--offline", "get", "--tag", tag) })
+		if err != nil || !strings.Contains(out, want) {
+			t.Errorf("offline get --tag %s = %q, %v; want %s", tag, out, err, want)
+		}
+	}
+}
+
+func TestListSortAndSince(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	srv := eggtest.NewServer(t)
+	cfg := newFakeConfig(t, srv)
+	if err := cfg.SaveTokens(srv.IssueTokens("user-1")); err != nil {
+		t.Fatal(err)
+	}
+	srv.Seed("user-1", "BETA", "333")
+	srv.Seed("user-1", "ALPHA", "22")
+	srv.Seed("user-1", "GAMMA", "1")
+	egg := newEggRunner(commands.ListCmd)
+	list := func(args ...string) []string {
+		t.Helper()
+		out, err := captureStdout(t, func() error { return egg(append([]string{"list"}, args...)...) })
+		if err != nil {
+			t.Fatalf("list %v: %v", args, err)
+		}
+		// The first column of the rows after the table header
+		_, table, _ := strings.Cut(out, "KEY ")
+		var keys []string
+		for _, line := range strings.Split(table, "\n")[1:] {
+			if fields := strings.Fields(line); len(fields) > 0 {
+				keys = append(keys, fields[0])
+			}
+		}
+		return keys
+	}
+
+	for _, tt := range []struct {
+		args []string
+		want []string
+	}{
+		{nil, []string{"ALPHA", "BETA", "GAMMA"}},
+		{[]string{"--reverse"}, []string{"GAMMA", "BETA", "ALPHA"}},
+		{[]string{"--sort", "size"}, []string{"GAMMA", "ALPHA", "BETA"}},
+		{[]string{"--sort", "size", "-r"}, []string{"BETA", "ALPHA", "GAMMA"}},
+		{[]string{"--since", "1h"}, []string{"ALPHA", "BETA", "GAMMA"}},
+		{[]string{"--since", time.Now().AddDate(0, 0, 2).Format("2006-01-02")}, nil},
+	} {
+		if got := list(tt.args...); !slices.Equal(got, tt.want) {
+			t.Errorf("list %v = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+
+	for _, args := range [][]string{{"--sort", "owner"}, {"--since", "last week"}} {
+		if err := egg(append([]string{"list"}, args...)...); err == nil {
+			t.Errorf("list %v succeeded, want an invalid flag error", args)
+		}
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("hatch test needs a POSIX shell")
+	}
+
+	srv := eggtest.NewServer(t)
+	cfg := newFakeConfig(t, srv)
+	if err := cfg.SaveTokens(srv.IssueTokens("user-1")); err != nil {
+		t.Fatal(err)
+	}
+	egg := newEggRunner(commands.AddCmd, commands.ExpiringCmd, commands.ListCmd, commands.RunCmd)
+
+	if err := egg("lay", "--expires", "2001-01-01", "OLD", "x"); err == nil {
+		t.Fatal("lay with an expiry in the past succeeded")
+	}
+	if err := egg("lay", "--expires", "90d", "LATER", "x"); err != nil {
+		t.Fatalf("lay --expires 90d: %v", err)
+	}
+	if err := egg("lay", "--expires", "5d", "SOON", "x"); err != nil {
+		t.Fatalf("lay --expires 5d: %v", err)
+	}
+	if err := egg("expiring", "--within", "1d"); err != nil {
+		t.Fatalf("expiring --within 1d = %v, want nothing found", err)
+	}
+
+	// The API doesn't stop expiry dates from passing
+	client := api.NewClient(srv.URL, srv.IssueTokens("user-1").AccessToken)
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	if _, err := client.UpdateEggMetadata(context.Background(), "user-1", "SOON", api.MetadataPatch{ExpiresAt: &past}); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := captureStdout(t, func() error { return egg("expiring", "--within", "14d", "--json") })
+	if commands.ExitCode(err) != commands.ExitExpiring {
+		t.Fatalf("expiring = %v, want exit %d", err, commands.ExitExpiring)
+	}
+	var found []struct {
+		SecretID string `json:"secret_id"`
+		Expired  bool   `json:"expired"`
+	}
+	if err := json.Unmarshal([]byte(out), &found); err != nil {
+		t.Fatalf("expiring --json printed %q: %v", out, err)
+	}
+	if len(found) != 1 || found[0].SecretID != "SOON" || !found[0].Expired {
+		t.Fatalf("expiring --json = %+v, want only SOON, expired", found)
+	}
+	if err := egg("list"); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	// hatch warns by default and refuses when the profile says so
+	if err := egg("hatch", "--", sh, "-c", "true"); err != nil {
+		t.Fatalf("hatch with an expired secret: %v", err)
+	}
+	t.Setenv("EGG_ON_EXPIRED", "refuse")
+	if err := egg("hatch", "--", sh, "-c", "true"); commands.ExitCode(err) != commands.ExitExpiring {
+		t.Fatalf("hatch with on_expired refuse = %v, want exit %d", err, commands.ExitExpiring)
+	}
+	if err := egg("hatch", "-k", "LATER", "--", sh, "-c", "true"); err != nil {
+		t.Fatalf("hatch of an unexpired secret with on_expired refuse: %v", err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("rotate test needs a POSIX shell")
+	}
+
+	srv := eggtest.NewServer(t)
+	cfg := newFakeConfig(t, srv)
+	if err := cfg.SaveTokens(srv.IssueTokens("user-1")); err != nil {
+		t.Fatal(err)
+	}
+	egg := newEggRunner(commands.AddCmd, commands.RotateCmd, commands.ExpiringCmd, commands.SyncCmd)
+	if err := egg("lay", "DB_PASSWORD", "hunter2"); err != nil {
+		t.Fatalf("lay: %v", err)
+	}
+
+	// A failing rotator leaves the secret alone
+	if err := egg("rotate", "DB_PASSWORD", "--rotator", sh+" -c false"); err == nil {
+		t.Fatal("rotate with a failing rotator succeeded")
+	}
+	if value, _ := srv.Secret("user-1", "DB_PASSWORD"); value != "hunter2" {
+		t.Fatalf("DB_PASSWORD = %q after a failed rotation, want hunter2", value)
+	}
+
+	// A successful one gets both values on stdin, and the new one is stored
+	script := filepath.Join(t.TempDir(), "rotator.sh")
+	input := filepath.Join(t.TempDir(), "input.json")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\ncat > "+input+"\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := egg("rotate", "DB_PASSWORD", "--rotator", script, "--charset", "hex", "--length", "40"); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	data, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		SecretID string `json:"secret_id"`
+		OldValue string `json:"old_value"`
+		NewValue string `json:"new_value"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("rotator read %q: %v", data, err)
+	}
+	value, _ := srv.Secret("user-1", "DB_PASSWORD")
+	if got.SecretID != "DB_PASSWORD" || got.OldValue != "hunter2" || got.NewValue != value || len(value) != 40 || strings.Trim(value, "0123456789abcdef") != "" {
+		t.Fatalf("rotator got %+v, stored %q", got, value)
+	}
+	if meta, _ := srv.Metadata("user-1", "DB_PASSWORD"); meta.RotatedAt == "" {
+		t.Fatal("rotation time not recorded")
+	}
+
+	// A change made while the rotator runs is not overwritten, and the new
+	// value goes to the outbox rather than the terminal
+	dir := t.TempDir()
+	slow := filepath.Join(dir, "slow.sh")
+	if err := os.WriteFile(slow, []byte("#!/bin/sh\ncat > "+input+"\ntouch "+dir+"/started\nwhile [ ! -e "+dir+"/go ]; do sleep 0.01; done\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			if _, err := os.Stat(filepath.Join(dir, "started")); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		srv.Seed("user-1", "DB_PASSWORD", "changed by a teammate")
+		os.WriteFile(filepath.Join(dir, "go"), nil, 0600)
+	}()
+	var stdout string
+	stderr, err := captureStderr(t, func() error {
+		var err error
+		stdout, err = captureStdout(t, func() error { return egg("rotate", "DB_PASSWORD", "--rotator", slow) })
+		return err
+	})
+	if commands.ExitCode(err) != commands.ExitConflict {
+		t.Fatalf("rotate during a concurrent change = %v, want exit %d", err, commands.ExitConflict)
+	}
+	if data, err = os.ReadFile(input); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stdout+stderr, got.NewValue) {
+		t.Fatalf("rotate printed the new value:\n%s%s", stdout, stderr)
+	}
+	if value, _ := srv.Secret("user-1", "DB_PASSWORD"); value != "changed by a teammate" {
+		t.Fatalf("DB_PASSWORD = %q, want the teammate's change kept", value)
+	}
+	if err := egg("sync", "--push"); commands.ExitCode(err) != commands.ExitConflict {
+		t.Fatalf("sync --push = %v, want exit %d", err, commands.ExitConflict)
+	}
+	if err := egg("sync", "--push", "--force"); err != nil {
+		t.Fatalf("sync --push --force: %v", err)
+	}
+	if value, _ := srv.Secret("user-1", "DB_PASSWORD"); value != got.NewValue {
+		t.Fatalf("DB_PASSWORD = %q after pushing the saved rotation, want the rotated value", value)
+	}
+
+	// Rotation reminders count from the last rotation, and are kept out of
+	// the expiry list CI jobs parse
+	t.Setenv("EGG_ROTATION_INTERVAL", "30d")
+	if err := egg("expiring", "--rotation", "--within", "7d"); err != nil {
+		t.Fatalf("expiring --rotation right after rotation = %v, want nothing due", err)
+	}
+	out, err := captureStdout(t, func() error { return egg("expiring", "--within", "60d", "--json") })
+	if err != nil || strings.TrimSpace(out) != "[]" {
+		t.Fatalf("expiring --within 60d --json = %q, %v, want no expiring secrets", out, err)
+	}
+	out, err = captureStdout(t, func() error { return egg("expiring", "--rotation", "--within", "60d", "--json") })
+	if commands.ExitCode(err) != commands.ExitExpiring {
+		t.Fatalf("expiring --rotation --within 60d = %v, want exit %d", err, commands.ExitExpiring)
+	}
+	var due []map[string]any
+	if err := json.Unmarshal([]byte(out), &due); err != nil {
+		t.Fatalf("expiring --rotation --json printed %q: %v", out, err)
+	}
+	if len(due) != 1 || due[0]["secret_id"] != "DB_PASSWORD" || due[0]["due_at"] == "" || due[0]["rotated_at"] == "" {
+		t.Fatalf("expiring --rotation --json = %v, want DB_PASSWORD due for rotation", due)
+	}
 }
 
 // Run tests with: